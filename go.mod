@@ -15,4 +15,5 @@ require (
 	github.com/hashicorp/go-cleanhttp v0.5.1
 	github.com/mitchellh/go-homedir v1.1.0 // indirect
 	github.com/zclconf/go-cty v0.0.0-20190430221426-d36a6f0dbffd
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	tfsdk "github.com/apparentlymart/terraform-sdk"
+	"github.com/buildkite/go-buildkite/buildkite"
+)
+
+// graphQLURL is the endpoint of the Buildkite GraphQL API, which we use for
+// the objects that the REST API cannot create or update.
+//
+// The go-buildkite client sends its API token with requests to any host, so
+// we use the same client for GraphQL requests as for REST requests.
+const graphQLURL = "https://graphql.buildkite.com/v1"
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors graphQLErrors   `json:"errors"`
+}
+
+// graphQLErrors is the list of errors in a GraphQL response, which we return
+// as an error when it is not empty.
+type graphQLErrors []struct {
+	Message string `json:"message"`
+}
+
+func (errs graphQLErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// doGraphQL sends the given GraphQL query or mutation to the Buildkite
+// GraphQL API, decoding the "data" property of the response into the value
+// pointed to by data.
+//
+// If the response includes errors then the result is a graphQLErrors error,
+// even if the response also includes data.
+func doGraphQL(client *buildkite.Client, query string, variables map[string]interface{}, data interface{}) (*buildkite.Response, error) {
+	req, err := client.NewRequest("POST", graphQLURL, &graphQLRequest{
+		Query:     query,
+		Variables: variables,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result graphQLResponse
+	resp, err := client.Do(req, &result)
+	if err != nil {
+		return resp, err
+	}
+	if len(result.Errors) != 0 {
+		return resp, result.Errors
+	}
+	if data != nil && len(result.Data) != 0 {
+		if err := json.Unmarshal(result.Data, data); err != nil {
+			return resp, err
+		}
+	}
+
+	return resp, nil
+}
+
+// graphQLWriteErrors is like apiWriteErrors, but for the result of doGraphQL.
+func graphQLWriteErrors(resp *buildkite.Response, err error) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+	if resp != nil && resp.StatusCode != http.StatusOK {
+		diags = diags.Append(apiResponseError(resp.Status))
+		return diags
+	}
+	switch err := err.(type) {
+	case nil:
+		// Okay
+	case graphQLErrors:
+		diags = diags.Append(tfsdk.Diagnostic{
+			Severity: tfsdk.Error,
+			Summary:  "Buildkite API request failed",
+			Detail:   fmt.Sprintf("The Buildkite GraphQL API returned an error: %s.", err),
+		})
+	default:
+		diags = diags.Append(tfsdk.Diagnostic{
+			Severity: tfsdk.Error,
+			Summary:  "Failed to connect to Buildkite GraphQL API",
+			Detail:   fmt.Sprintf("The Buildkite GraphQL API is not available: %s.", err),
+		})
+	}
+	return diags
+}
@@ -0,0 +1,627 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/buildkite/go-buildkite/buildkite"
+)
+
+// apiPipeline is our own representation of a pipeline object in the Buildkite
+// REST API, used for both requests and responses.
+//
+// The Pipeline type in the go-buildkite library covers only a small subset of
+// the pipeline settings, and its Update method can send only the name,
+// repository, and steps, so we use the library only for its HTTP client
+// and define the objects ourselves.
+type apiPipeline struct {
+	// Read-only
+	ID        *string              `json:"id,omitempty"`
+	URL       *string              `json:"url,omitempty"`
+	WebURL    *string              `json:"web_url,omitempty"`
+	Slug      *string              `json:"slug,omitempty"`
+	BuildsURL *string              `json:"builds_url,omitempty"`
+	BadgeURL  *string              `json:"badge_url,omitempty"`
+	CreatedAt *buildkite.Timestamp `json:"created_at,omitempty"`
+
+	// ArchivedAt is set only for pipelines that have been archived.
+	ArchivedAt *buildkite.Timestamp `json:"archived_at,omitempty"`
+
+	Name       *string    `json:"name,omitempty"`
+	Repository *string    `json:"repository,omitempty"`
+	Steps      []*apiStep `json:"steps,omitempty"`
+
+	// Configuration is the pipeline's steps in Buildkite's YAML format, used
+	// instead of Steps for pipelines that are defined with steps_yaml. It is
+	// sent as an empty string to clear it from pipelines that use Steps.
+	Configuration *string `json:"configuration,omitempty"`
+
+	// The settings below are always sent, so that unsetting one in the
+	// configuration will reset it in the remote object.
+	Description                     *string `json:"description"`
+	DefaultBranch                   *string `json:"default_branch"`
+	BranchConfiguration             *string `json:"branch_configuration"`
+	SkipQueuedBranchBuilds          *bool   `json:"skip_queued_branch_builds"`
+	SkipQueuedBranchBuildsFilter    *string `json:"skip_queued_branch_builds_filter"`
+	CancelRunningBranchBuilds       *bool   `json:"cancel_running_branch_builds"`
+	CancelRunningBranchBuildsFilter *string `json:"cancel_running_branch_builds_filter"`
+	DefaultTimeoutInMinutes         *int    `json:"default_timeout_in_minutes"`
+	MaximumTimeoutInMinutes         *int    `json:"maximum_timeout_in_minutes"`
+	Visibility                      *string `json:"visibility,omitempty"`
+
+	// ProviderSettings is used only for requests, while Provider is populated
+	// only in responses.
+	ProviderSettings *apiProviderSettings `json:"provider_settings,omitempty"`
+	Provider         *apiProvider         `json:"provider,omitempty"`
+
+	// Notify is always sent, so that removing all of the notify blocks from
+	// the configuration will remove the notifications from Buildkite.
+	Notify []*apiNotification `json:"notify"`
+}
+
+// apiProvider describes the VCS service that hosts a pipeline's repository.
+type apiProvider struct {
+	ID       string              `json:"id"`
+	Settings apiProviderSettings `json:"settings"`
+}
+
+// apiProviderSettings is a union of the settings for all of the VCS providers
+// that Buildkite supports. Only some of the settings are meaningful for each
+// provider.
+type apiProviderSettings struct {
+	TriggerMode                             *string `json:"trigger_mode,omitempty"`
+	BuildPullRequests                       *bool   `json:"build_pull_requests,omitempty"`
+	PullRequestBranchFilterEnabled          *bool   `json:"pull_request_branch_filter_enabled,omitempty"`
+	PullRequestBranchFilterConfiguration    *string `json:"pull_request_branch_filter_configuration,omitempty"`
+	SkipPullRequestBuildsForExistingCommits *bool   `json:"skip_pull_request_builds_for_existing_commits,omitempty"`
+	BuildTags                               *bool   `json:"build_tags,omitempty"`
+	PublishCommitStatus                     *bool   `json:"publish_commit_status,omitempty"`
+	PublishCommitStatusPerStep              *bool   `json:"publish_commit_status_per_step,omitempty"`
+	SeparatePullRequestStatuses             *bool   `json:"separate_pull_request_statuses,omitempty"`
+	PrefixPullRequestForkBranchNames        *bool   `json:"prefix_pull_request_fork_branch_names,omitempty"`
+	FilterEnabled                           *bool   `json:"filter_enabled,omitempty"`
+	FilterCondition                         *string `json:"filter_condition,omitempty"`
+}
+
+// apiStep is our own representation of a step object within a pipeline in
+// the Buildkite REST API. See apiPipeline for why we don't use the types
+// from go-buildkite here.
+type apiStep struct {
+	Type *string `json:"type,omitempty"`
+	Name *string `json:"name,omitempty"`
+
+	Key                    *string         `json:"key,omitempty"`
+	DependsOn              apiDependencies `json:"depends_on,omitempty"`
+	AllowDependencyFailure *bool           `json:"allow_dependency_failure,omitempty"`
+	If                     *string         `json:"if,omitempty"`
+
+	Command         *string           `json:"command,omitempty"`
+	Env             map[string]string `json:"env,omitempty"`
+	AgentQueryRules []string          `json:"agent_query_rules,omitempty"`
+
+	// For "script" steps only
+	ArtifactPaths        *string      `json:"artifact_paths,omitempty"`
+	BranchConfiguration  *string      `json:"branch_configuration,omitempty"`
+	TimeoutInMinutes     *int         `json:"timeout_in_minutes,omitempty"`
+	Parallelism          *int         `json:"parallelism,omitempty"`
+	Concurrency          *int         `json:"concurrency,omitempty"`
+	ConcurrencyGroup     *string      `json:"concurrency_group,omitempty"`
+	Priority             *int         `json:"priority,omitempty"`
+	SoftFail             *apiSoftFail `json:"soft_fail,omitempty"`
+	Skip                 *apiSkip     `json:"skip,omitempty"`
+	CancelOnBuildFailing *bool        `json:"cancel_on_build_failing,omitempty"`
+	Retry                *apiRetry    `json:"retry,omitempty"`
+	Plugins              apiPlugins   `json:"plugins,omitempty"`
+	Matrix               *apiMatrix   `json:"matrix,omitempty"`
+
+	// For "script" and "group" steps only
+	Notify []*apiNotification `json:"notify,omitempty"`
+
+	// For "waiter" steps only
+	ContinueOnFailure *bool `json:"continue_on_failure,omitempty"`
+
+	// For "trigger" steps only
+	TriggerProjectSlug *string           `json:"trigger_project_slug,omitempty"`
+	TriggerAsync       *bool             `json:"trigger_async,omitempty"`
+	TriggerMessage     *string           `json:"trigger_message,omitempty"`
+	TriggerCommit      *string           `json:"trigger_commit,omitempty"`
+	TriggerBranch      *string           `json:"trigger_branch,omitempty"`
+	TriggerEnv         map[string]string `json:"trigger_env,omitempty"`
+	TriggerMetaData    map[string]string `json:"trigger_meta_data,omitempty"`
+
+	// For "group" steps only. Group steps use Group instead of Name for
+	// their label.
+	Group *string    `json:"group,omitempty"`
+	Steps []*apiStep `json:"steps,omitempty"`
+
+	// For "manual" steps only
+	Prompt       *string         `json:"prompt,omitempty"`
+	BlockedState *string         `json:"blocked_state,omitempty"`
+	Fields       []*apiStepField `json:"fields,omitempty"`
+}
+
+// apiNotification is a single entry in the notify list of a pipeline or
+// step. Exactly one of the fields other than If is set.
+type apiNotification struct {
+	Email                *string                            `json:"email,omitempty"`
+	BasecampCampfire     *string                            `json:"basecamp_campfire,omitempty"`
+	Slack                *apiSlackNotification              `json:"slack,omitempty"`
+	Webhook              *string                            `json:"webhook,omitempty"`
+	PagerdutyChangeEvent *string                            `json:"pagerduty_change_event,omitempty"`
+	GitHubCommitStatus   *apiGitHubCommitStatusNotification `json:"github_commit_status,omitempty"`
+	If                   *string                            `json:"if,omitempty"`
+}
+
+// apiSlackNotification describes a Slack notification. We always send an
+// object, but the API also accepts and may return a single channel name.
+type apiSlackNotification struct {
+	Channels []string `json:"channels,omitempty"`
+	Message  *string  `json:"message,omitempty"`
+}
+
+func (n *apiSlackNotification) UnmarshalJSON(buf []byte) error {
+	var channel string
+	if err := json.Unmarshal(buf, &channel); err == nil {
+		*n = apiSlackNotification{Channels: []string{channel}}
+		return nil
+	}
+	type plain apiSlackNotification // plain has no UnmarshalJSON method
+	return json.Unmarshal(buf, (*plain)(n))
+}
+
+type apiGitHubCommitStatusNotification struct {
+	Context *string `json:"context,omitempty"`
+}
+
+// apiDependencies is the list of steps that a step depends on. We always
+// send a list of objects, but the API also accepts and may return a single
+// key string or a list that mixes key strings and objects.
+type apiDependencies []*apiDependency
+
+type apiDependency struct {
+	Step         string `json:"step"`
+	AllowFailure *bool  `json:"allow_failure,omitempty"`
+}
+
+func (ds *apiDependencies) UnmarshalJSON(buf []byte) error {
+	*ds = nil
+
+	var single string
+	if err := json.Unmarshal(buf, &single); err == nil {
+		if single != "" {
+			*ds = apiDependencies{{Step: single}}
+		}
+		return nil
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(buf, &list); err != nil {
+		return fmt.Errorf("depends_on must be either a string or a list")
+	}
+	for _, item := range list {
+		var key string
+		if err := json.Unmarshal(item, &key); err == nil {
+			*ds = append(*ds, &apiDependency{Step: key})
+			continue
+		}
+		dep := &apiDependency{}
+		if err := json.Unmarshal(item, dep); err != nil {
+			return fmt.Errorf("each dependency must be either a step key or an object")
+		}
+		*ds = append(*ds, dep)
+	}
+	return nil
+}
+
+// apiSoftFail is the soft_fail property of a step, which the API represents
+// either as a boolean or as a list of objects giving the exit statuses that
+// should not fail the build.
+type apiSoftFail struct {
+	All          bool
+	ExitStatuses []int
+}
+
+type apiSoftFailExitStatus struct {
+	ExitStatus json.RawMessage `json:"exit_status"`
+}
+
+func (sf apiSoftFail) MarshalJSON() ([]byte, error) {
+	if len(sf.ExitStatuses) == 0 {
+		return json.Marshal(sf.All)
+	}
+	raw := make([]map[string]int, len(sf.ExitStatuses))
+	for i, status := range sf.ExitStatuses {
+		raw[i] = map[string]int{"exit_status": status}
+	}
+	return json.Marshal(raw)
+}
+
+func (sf *apiSoftFail) UnmarshalJSON(buf []byte) error {
+	*sf = apiSoftFail{}
+	if err := json.Unmarshal(buf, &sf.All); err == nil {
+		return nil
+	}
+
+	var raw []apiSoftFailExitStatus
+	if err := json.Unmarshal(buf, &raw); err != nil {
+		return fmt.Errorf("soft_fail must be either a boolean or a list of exit statuses")
+	}
+	for _, item := range raw {
+		var status int
+		if err := json.Unmarshal(item.ExitStatus, &status); err != nil {
+			// The only non-number exit status is the "*" wildcard, which
+			// is equivalent to soft_fail: true.
+			sf.All = true
+			sf.ExitStatuses = nil
+			return nil
+		}
+		sf.ExitStatuses = append(sf.ExitStatuses, status)
+	}
+	return nil
+}
+
+// apiSkip is the skip property of a step, which the API represents either as
+// a boolean or as a string giving the reason for skipping.
+type apiSkip struct {
+	Skip   bool
+	Reason string
+}
+
+func (s apiSkip) MarshalJSON() ([]byte, error) {
+	if s.Reason != "" {
+		return json.Marshal(s.Reason)
+	}
+	return json.Marshal(s.Skip)
+}
+
+func (s *apiSkip) UnmarshalJSON(buf []byte) error {
+	*s = apiSkip{}
+	if err := json.Unmarshal(buf, &s.Skip); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(buf, &s.Reason); err != nil {
+		return fmt.Errorf("skip must be either a boolean or a string")
+	}
+	s.Skip = s.Reason != ""
+	return nil
+}
+
+// apiRetry describes the conditions under which a step's jobs are retried.
+type apiRetry struct {
+	Automatic apiAutomaticRetries `json:"automatic,omitempty"`
+	Manual    *apiManualRetry     `json:"manual,omitempty"`
+}
+
+// apiAutomaticRetries is the list of automatic retry rules for a step. We
+// always send a list, but the API also accepts and may return a boolean or a
+// single rule object.
+type apiAutomaticRetries []*apiAutomaticRetry
+
+type apiAutomaticRetry struct {
+	ExitStatus   *apiExitStatus `json:"exit_status,omitempty"`
+	Limit        *int           `json:"limit,omitempty"`
+	SignalReason *string        `json:"signal_reason,omitempty"`
+}
+
+func (r *apiAutomaticRetries) UnmarshalJSON(buf []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(buf, &enabled); err == nil {
+		// A boolean true is equivalent to a single rule using Buildkite's
+		// defaults for all of the rule settings.
+		*r = nil
+		if enabled {
+			*r = apiAutomaticRetries{{}}
+		}
+		return nil
+	}
+	var single apiAutomaticRetry
+	if err := json.Unmarshal(buf, &single); err == nil {
+		*r = apiAutomaticRetries{&single}
+		return nil
+	}
+	var list []*apiAutomaticRetry
+	if err := json.Unmarshal(buf, &list); err != nil {
+		return fmt.Errorf("automatic retry must be a boolean, a rule object, or a list of rules")
+	}
+	*r = list
+	return nil
+}
+
+type apiManualRetry struct {
+	Allowed        *bool   `json:"allowed,omitempty"`
+	PermitOnPassed *bool   `json:"permit_on_passed,omitempty"`
+	Reason         *string `json:"reason,omitempty"`
+}
+
+func (r *apiManualRetry) UnmarshalJSON(buf []byte) error {
+	var allowed bool
+	if err := json.Unmarshal(buf, &allowed); err == nil {
+		*r = apiManualRetry{Allowed: &allowed}
+		return nil
+	}
+	type plain apiManualRetry // plain has no UnmarshalJSON method
+	return json.Unmarshal(buf, (*plain)(r))
+}
+
+// apiExitStatus is a process exit status, which the API represents either as
+// an integer or as the string "*" to match any exit status. We use the
+// string form of the number in both cases.
+type apiExitStatus string
+
+func (s apiExitStatus) MarshalJSON() ([]byte, error) {
+	if n, err := strconv.Atoi(string(s)); err == nil {
+		return json.Marshal(n)
+	}
+	return json.Marshal(string(s))
+}
+
+func (s *apiExitStatus) UnmarshalJSON(buf []byte) error {
+	var n int
+	if err := json.Unmarshal(buf, &n); err == nil {
+		*s = apiExitStatus(strconv.Itoa(n))
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(buf, &str); err != nil {
+		return fmt.Errorf("exit status must be either an integer or \"*\"")
+	}
+	*s = apiExitStatus(str)
+	return nil
+}
+
+// apiPlugins is the list of plugins used by a step, in the order they run.
+//
+// We always send a list of single-key objects mapping each plugin source to
+// its configuration, but the API also accepts and may return a single object
+// with one key per plugin, or bare source strings for plugins that have no
+// configuration.
+type apiPlugins []*apiPlugin
+
+type apiPlugin struct {
+	Source string
+	Config json.RawMessage
+}
+
+func (ps apiPlugins) MarshalJSON() ([]byte, error) {
+	raw := make([]map[string]json.RawMessage, len(ps))
+	for i, p := range ps {
+		config := p.Config
+		if len(config) == 0 {
+			config = json.RawMessage("null")
+		}
+		raw[i] = map[string]json.RawMessage{p.Source: config}
+	}
+	return json.Marshal(raw)
+}
+
+func (ps *apiPlugins) UnmarshalJSON(buf []byte) error {
+	*ps = nil
+
+	var single map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &single); err == nil {
+		// Go's maps don't preserve the order of the keys, so we'll sort
+		// them to at least get a consistent result.
+		sources := make([]string, 0, len(single))
+		for source := range single {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+		for _, source := range sources {
+			*ps = append(*ps, &apiPlugin{Source: source, Config: single[source]})
+		}
+		return nil
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(buf, &list); err != nil {
+		return fmt.Errorf("plugins must be either an object or a list")
+	}
+	for _, item := range list {
+		var source string
+		if err := json.Unmarshal(item, &source); err == nil {
+			*ps = append(*ps, &apiPlugin{Source: source})
+			continue
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(item, &obj); err != nil || len(obj) != 1 {
+			return fmt.Errorf("each plugin must be either a source string or an object with a single key")
+		}
+		for source, config := range obj {
+			*ps = append(*ps, &apiPlugin{Source: source, Config: config})
+		}
+	}
+	return nil
+}
+
+// apiMatrix describes the combinations of values that a step's command
+// runs with. Values is used for a single anonymous dimension, while Setup
+// gives the values of each of several named dimensions.
+type apiMatrix struct {
+	Values      []string
+	Setup       map[string][]string
+	Adjustments []*apiMatrixAdjustment
+}
+
+type apiMatrixAdjustment struct {
+	With     map[string]string `json:"with"`
+	Skip     *apiSkip          `json:"skip,omitempty"`
+	SoftFail *apiSoftFail      `json:"soft_fail,omitempty"`
+}
+
+type apiMatrixObject struct {
+	Setup       json.RawMessage        `json:"setup"`
+	Adjustments []*apiMatrixAdjustment `json:"adjustments,omitempty"`
+}
+
+func (m apiMatrix) MarshalJSON() ([]byte, error) {
+	if m.Setup == nil {
+		return json.Marshal(m.Values)
+	}
+	setup, err := json.Marshal(m.Setup)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(apiMatrixObject{
+		Setup:       setup,
+		Adjustments: m.Adjustments,
+	})
+}
+
+func (m *apiMatrix) UnmarshalJSON(buf []byte) error {
+	*m = apiMatrix{}
+
+	var values []json.RawMessage
+	if err := json.Unmarshal(buf, &values); err == nil {
+		m.Values = jsonScalarStrings(values)
+		return nil
+	}
+
+	var obj struct {
+		Setup       json.RawMessage   `json:"setup"`
+		Adjustments []json.RawMessage `json:"adjustments"`
+	}
+	if err := json.Unmarshal(buf, &obj); err != nil {
+		return fmt.Errorf("matrix must be either a list or an object")
+	}
+	if err := json.Unmarshal(obj.Setup, &values); err == nil {
+		m.Values = jsonScalarStrings(values)
+	} else {
+		var setup map[string][]json.RawMessage
+		if err := json.Unmarshal(obj.Setup, &setup); err != nil {
+			return fmt.Errorf("matrix setup must be either a list or an object of lists")
+		}
+		m.Setup = make(map[string][]string, len(setup))
+		for name, values := range setup {
+			m.Setup[name] = jsonScalarStrings(values)
+		}
+	}
+	for _, raw := range obj.Adjustments {
+		// Adjustments for a single anonymous dimension have a scalar
+		// "with" value, which we don't support.
+		adj := &apiMatrixAdjustment{}
+		if err := json.Unmarshal(raw, adj); err == nil {
+			m.Adjustments = append(m.Adjustments, adj)
+		}
+	}
+	return nil
+}
+
+// jsonScalarStrings converts the given JSON scalar values to strings, using
+// the JSON syntax for anything other than strings.
+func jsonScalarStrings(raws []json.RawMessage) []string {
+	ret := make([]string, len(raws))
+	for i, raw := range raws {
+		if err := json.Unmarshal(raw, &ret[i]); err != nil {
+			ret[i] = string(raw)
+		}
+	}
+	return ret
+}
+
+// apiStepField is a field in the form that is shown when a "manual" step is
+// unblocked. Exactly one of Text or Select is set, depending on the field type.
+type apiStepField struct {
+	Text     *string               `json:"text,omitempty"`
+	Select   *string               `json:"select,omitempty"`
+	Key      string                `json:"key"`
+	Hint     *string               `json:"hint,omitempty"`
+	Required *bool                 `json:"required,omitempty"`
+	Default  *string               `json:"default,omitempty"`
+	Format   *string               `json:"format,omitempty"`
+	Multiple *bool                 `json:"multiple,omitempty"`
+	Options  []*apiStepFieldOption `json:"options,omitempty"`
+}
+
+type apiStepFieldOption struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// getPipeline fetches the pipeline with the given slug from the given
+// organization.
+func getPipeline(client *buildkite.Client, org, slug string) (*apiPipeline, *buildkite.Response, error) {
+	u := fmt.Sprintf("v2/organizations/%s/pipelines/%s", org, slug)
+
+	req, err := client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pipeline := new(apiPipeline)
+	resp, err := client.Do(req, pipeline)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return pipeline, resp, err
+}
+
+// createPipeline creates a new pipeline in the given organization, returning
+// the pipeline object that the API created.
+func createPipeline(client *buildkite.Client, org string, p *apiPipeline) (*apiPipeline, *buildkite.Response, error) {
+	u := fmt.Sprintf("v2/organizations/%s/pipelines", org)
+
+	req, err := client.NewRequest("POST", u, p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pipeline := new(apiPipeline)
+	resp, err := client.Do(req, pipeline)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return pipeline, resp, err
+}
+
+// updatePipeline updates the pipeline with the given slug in the given
+// organization, returning the updated pipeline object.
+//
+// The slug of the result may differ from the given slug if the update
+// changed the pipeline's name.
+func updatePipeline(client *buildkite.Client, org, slug string, p *apiPipeline) (*apiPipeline, *buildkite.Response, error) {
+	u := fmt.Sprintf("v2/organizations/%s/pipelines/%s", org, slug)
+
+	req, err := client.NewRequest("PATCH", u, p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pipeline := new(apiPipeline)
+	resp, err := client.Do(req, pipeline)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return pipeline, resp, err
+}
+
+// archivePipeline archives the pipeline with the given slug in the given
+// organization. An archived pipeline keeps its build history, but cannot
+// run new builds until it is unarchived.
+func archivePipeline(client *buildkite.Client, org, slug string) (*buildkite.Response, error) {
+	u := fmt.Sprintf("v2/organizations/%s/pipelines/%s/archive", org, slug)
+
+	req, err := client.NewRequest("POST", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Do(req, nil)
+}
+
+// unarchivePipeline restores the archived pipeline with the given slug in the
+// given organization.
+func unarchivePipeline(client *buildkite.Client, org, slug string) (*buildkite.Response, error) {
+	u := fmt.Sprintf("v2/organizations/%s/pipelines/%s/unarchive", org, slug)
+
+	req, err := client.NewRequest("POST", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Do(req, nil)
+}
@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"github.com/buildkite/go-buildkite/buildkite"
+)
+
+// apiTeam is our representation of a team object in the Buildkite GraphQL
+// API, used for both mutation inputs and query results.
+//
+// The go-buildkite library can only list teams using the REST API, so teams
+// are managed using GraphQL instead.
+type apiTeam struct {
+	// Read-only
+	ID   *string `json:"id,omitempty"`
+	UUID *string `json:"uuid,omitempty"`
+	Slug *string `json:"slug,omitempty"`
+
+	// OrganizationID is used only in the input to teamCreate.
+	OrganizationID *string `json:"organizationID,omitempty"`
+
+	// buildAPITeamFromMRT always sets the settings below, filling in
+	// Buildkite's defaults for any that the configuration leaves unset.
+	Name                      *string `json:"name"`
+	Description               *string `json:"description"`
+	Privacy                   *string `json:"privacy"`
+	IsDefaultTeam             *bool   `json:"isDefaultTeam"`
+	DefaultMemberRole         *string `json:"defaultMemberRole"`
+	MembersCanCreatePipelines *bool   `json:"membersCanCreatePipelines"`
+}
+
+// graphQLTeamFields is the selection of team fields that we decode into an
+// apiTeam.
+const graphQLTeamFields = `
+	id
+	uuid
+	slug
+	name
+	description
+	privacy
+	isDefaultTeam
+	defaultMemberRole
+	membersCanCreatePipelines
+`
+
+// getTeam fetches the team with the given GraphQL ID. The result is nil if
+// there is no such team.
+func getTeam(client *buildkite.Client, id string) (*apiTeam, *buildkite.Response, error) {
+	var data struct {
+		Node *apiTeam `json:"node"`
+	}
+	resp, err := doGraphQL(client, `
+		query GetTeam($id: ID!) {
+			node(id: $id) {
+				... on Team {`+graphQLTeamFields+`}
+			}
+		}
+	`, map[string]interface{}{"id": id}, &data)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	// A node that exists but isn't a team decodes as an empty object.
+	if data.Node == nil || data.Node.ID == nil {
+		return nil, resp, nil
+	}
+	return data.Node, resp, nil
+}
+
+// getOrganizationGraphQLID returns the GraphQL ID of the organization with
+// the given slug, which differs from the ID returned by the REST API. The
+// result is nil if there is no such organization.
+func getOrganizationGraphQLID(client *buildkite.Client, org string) (*string, *buildkite.Response, error) {
+	var data struct {
+		Organization *struct {
+			ID *string `json:"id"`
+		} `json:"organization"`
+	}
+	resp, err := doGraphQL(client, `
+		query GetOrganizationID($slug: ID!) {
+			organization(slug: $slug) {
+				id
+			}
+		}
+	`, map[string]interface{}{"slug": org}, &data)
+	if err != nil || data.Organization == nil {
+		return nil, resp, err
+	}
+
+	return data.Organization.ID, resp, nil
+}
+
+// createTeam creates a new team in the organization whose GraphQL ID is set in
+// t.OrganizationID, returning the team object that the API created.
+func createTeam(client *buildkite.Client, t *apiTeam) (*apiTeam, *buildkite.Response, error) {
+	var data struct {
+		TeamCreate struct {
+			TeamEdge struct {
+				Node *apiTeam `json:"node"`
+			} `json:"teamEdge"`
+		} `json:"teamCreate"`
+	}
+	resp, err := doGraphQL(client, `
+		mutation CreateTeam($input: TeamCreateInput!) {
+			teamCreate(input: $input) {
+				teamEdge {
+					node {`+graphQLTeamFields+`}
+				}
+			}
+		}
+	`, map[string]interface{}{"input": t}, &data)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return data.TeamCreate.TeamEdge.Node, resp, nil
+}
+
+// updateTeam updates the team with the given GraphQL ID, returning the
+// updated team object.
+//
+// The slug of the result may differ from the prior slug if the update changed
+// the team's name.
+func updateTeam(client *buildkite.Client, id string, t *apiTeam) (*apiTeam, *buildkite.Response, error) {
+	input := *t
+	input.ID = &id
+
+	var data struct {
+		TeamUpdate struct {
+			Team *apiTeam `json:"team"`
+		} `json:"teamUpdate"`
+	}
+	resp, err := doGraphQL(client, `
+		mutation UpdateTeam($input: TeamUpdateInput!) {
+			teamUpdate(input: $input) {
+				team {`+graphQLTeamFields+`}
+			}
+		}
+	`, map[string]interface{}{"input": &input}, &data)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return data.TeamUpdate.Team, resp, nil
+}
+
+// deleteTeam deletes the team with the given GraphQL ID.
+func deleteTeam(client *buildkite.Client, id string) (*buildkite.Response, error) {
+	return doGraphQL(client, `
+		mutation DeleteTeam($input: TeamDeleteInput!) {
+			teamDelete(input: $input) {
+				deletedTeamID
+			}
+		}
+	`, map[string]interface{}{
+		"input": map[string]interface{}{"id": id},
+	}, nil)
+}
@@ -3,7 +3,6 @@ package provider
 import (
 	"context"
 	"fmt"
-	"net/http"
 
 	tfsdk "github.com/apparentlymart/terraform-sdk"
 	"github.com/apparentlymart/terraform-sdk/tfschema"
@@ -82,39 +81,23 @@ func organizationDataResourceType() tfsdk.DataResourceType {
 		ReadFn: func(ctx context.Context, meta *Meta, obj *organizationDRT) (*organizationDRT, tfsdk.Diagnostics) {
 			var diags tfsdk.Diagnostics
 
-			orgSlug := *meta.org.Slug
-			if obj.Slug != nil {
-				orgSlug = *obj.Slug
-			}
-
 			var apiOrg *buildkite.Organization
-			switch {
-			case orgSlug == *meta.org.Slug:
-				// Easy! We already loaded this during configuration.
-				apiOrg = meta.org
-			default:
-				org, resp, err := meta.client.Organizations.Get(orgSlug)
-				if resp != nil {
-					switch resp.StatusCode {
-					case http.StatusNotFound:
-						diags = diags.Append(tfsdk.Diagnostic{
-							Severity: tfsdk.Error,
-							Summary:  "Buildkite organization not found",
-							Detail:   fmt.Sprintf("Cannot find organization %q. Either the organization does not exist or your current API credentials do not have API access to it.", orgSlug),
-							Path:     cty.GetAttrPath("slug"),
-						})
-						return obj, diags
-					case http.StatusOK:
-						apiOrg = org
-					default:
-						diags = diags.Append(apiResponseError(resp.Status))
-						return obj, diags
-					}
-				}
-				if err != nil {
-					diags = diags.Append(apiConnectionError(err))
-					return obj, diags
-				}
+			if obj.Slug == nil {
+				// Easy! This is the organization from the provider
+				// configuration.
+				org, moreDiags := meta.defaultOrg()
+				diags = diags.Append(moreDiags)
+				apiOrg = org
+			} else {
+				// The Meta caches the organizations we look up, so this
+				// doesn't hit the API again for an organization that other
+				// resources have already used.
+				org, moreDiags := meta.organization(*obj.Slug)
+				diags = diags.Append(moreDiags.UnderPath(cty.GetAttrPath("slug")))
+				apiOrg = org
+			}
+			if diags.HasErrors() {
+				return obj, diags
 			}
 
 			createdTime := apiOrg.CreatedAt.Format(timestampFormat)
@@ -3,6 +3,7 @@ package provider
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
 
 	tfsdk "github.com/apparentlymart/terraform-sdk"
@@ -23,23 +24,29 @@ type pipelineMRT struct {
 	BadgeURL    *string `cty:"badge_url"`
 	CreatedTime *string `cty:"created_time"`
 
-	// TODO: VCS-provider-specific settings.
-
-	Steps []pipelineMRTStep `cty:"step"`
-
-	Organization *string `cty:"organization"`
-}
-
-type pipelineMRTStep struct {
-	Type  string  `cty:"type"`
-	Label *string `cty:"label"`
-
-	// For "script" steps only
-	Command         *string            `cty:"command"`
-	Env             *map[string]string `cty:"env"`
-	AgentQueryRules *[]string          `cty:"agent_query_rules"`
-
-	// TODO: All of the other supported attributes
+	Description                     *string `cty:"description"`
+	DefaultBranch                   *string `cty:"default_branch"`
+	BranchConfiguration             *string `cty:"branch_configuration"`
+	SkipQueuedBranchBuilds          *bool   `cty:"skip_queued_branch_builds"`
+	SkipQueuedBranchBuildsFilter    *string `cty:"skip_queued_branch_builds_filter"`
+	CancelRunningBranchBuilds       *bool   `cty:"cancel_running_branch_builds"`
+	CancelRunningBranchBuildsFilter *string `cty:"cancel_running_branch_builds_filter"`
+	DefaultTimeoutInMinutes         *int    `cty:"default_timeout_in_minutes"`
+	MaximumTimeoutInMinutes         *int    `cty:"maximum_timeout_in_minutes"`
+	Visibility                      *string `cty:"visibility"`
+
+	ProviderSettings *pipelineMRTProviderSettings `cty:"provider_settings"`
+	Notify           []pipelineMRTNotify          `cty:"notify"`
+
+	Steps     []pipelineMRTStep `cty:"step"`
+	StepsYAML *string           `cty:"steps_yaml"`
+
+	Organization  *string `cty:"organization"`
+	AdoptExisting *bool   `cty:"adopt_existing"`
+	Archived      *bool   `cty:"archived"`
+
+	DeletionProtection *bool   `cty:"deletion_protection"`
+	OnDestroy          *string `cty:"on_destroy"`
 }
 
 func pipelineManagedResourceType() tfsdk.ManagedResourceType {
@@ -55,23 +62,73 @@ func pipelineManagedResourceType() tfsdk.ManagedResourceType {
 					Required: true,
 				},
 
-				"slug": {
+				"description": {
+					Type:     cty.String,
+					Optional: true,
+				},
+				"default_branch": {
+					Type:     cty.String,
+					Optional: true,
+				},
+				"branch_configuration": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Branch filter pattern limiting which pushed branches will trigger builds.",
+				},
+				"skip_queued_branch_builds": {
+					Type:     cty.Bool,
+					Optional: true,
+				},
+				"skip_queued_branch_builds_filter": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Branch filter pattern limiting which branches skip_queued_branch_builds applies to.",
+				},
+				"cancel_running_branch_builds": {
+					Type:     cty.Bool,
+					Optional: true,
+				},
+				"cancel_running_branch_builds_filter": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Branch filter pattern limiting which branches cancel_running_branch_builds applies to.",
+				},
+				"default_timeout_in_minutes": {
+					Type:       cty.Number,
+					Optional:   true,
+					ValidateFn: validateTimeoutInMinutes,
+				},
+				"maximum_timeout_in_minutes": {
+					Type:       cty.Number,
+					Optional:   true,
+					ValidateFn: validateTimeoutInMinutes,
+				},
+				"visibility": {
 					Type:        cty.String,
 					Optional:    true,
 					Computed:    true,
-					Description: "Slug of the organization to retrieve. If not specified, then the organization slug configured in the provider is used.",
+					Description: "Either \"private\" or \"public\". If not specified, Buildkite's default visibility is used.",
 
 					ValidateFn: func(val string) tfsdk.Diagnostics {
 						var diags tfsdk.Diagnostics
-						if val == "" {
+						switch val {
+						case "private", "public":
+							// Okay
+						default:
 							diags = diags.Append(tfsdk.ValidationError(
-								fmt.Errorf("an organization slug must not be empty"),
+								fmt.Errorf("must be either \"private\" or \"public\""),
 							))
 						}
 						return diags
 					},
 				},
 
+				"slug": {
+					Type:        cty.String,
+					Computed:    true,
+					Description: "The pipeline's slug, which Buildkite derives from its name and uses in its URLs.",
+				},
+
 				"id": {
 					Type:     cty.String,
 					Computed: true,
@@ -96,53 +153,122 @@ func pipelineManagedResourceType() tfsdk.ManagedResourceType {
 					Type:     cty.String,
 					Computed: true,
 				},
+				"adopt_existing": {
+					Type:        cty.Bool,
+					Optional:    true,
+					Description: "If true, creating a pipeline whose slug is already taken adopts and updates the existing pipeline, rather than failing.",
+				},
+				"archived": {
+					Type:        cty.Bool,
+					Optional:    true,
+					Description: "If true, the pipeline is archived, keeping its build history but preventing new builds. If not set, a pipeline that was archived outside of Terraform is restored.",
+				},
+				"deletion_protection": {
+					Type:        cty.Bool,
+					Optional:    true,
+					Description: "If true, Terraform refuses to destroy the pipeline.",
+				},
+				"on_destroy": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "What to do with the pipeline when it is destroyed: \"delete\" (the default) to delete it permanently, or \"archive\" to keep its build history. An archived pipeline keeps its slug, so a new pipeline with the same name must set adopt_existing to take it over.",
+
+					ValidateFn: func(val string) tfsdk.Diagnostics {
+						var diags tfsdk.Diagnostics
+						switch val {
+						case "archive", "delete":
+							// Okay
+						default:
+							diags = diags.Append(tfsdk.ValidationError(
+								fmt.Errorf("must be either \"archive\" or \"delete\""),
+							))
+						}
+						return diags
+					},
+				},
+				"steps_yaml": {
+					Type:        cty.String,
+					Optional:    true,
+					Computed:    true,
+					Description: "The pipeline's steps in Buildkite's YAML format, as an alternative to \"step\" blocks. If \"step\" blocks are used instead, this is the YAML equivalent of those steps. Terraform requires the planned value to match the configuration exactly, so reformatting this YAML or switching between equivalent step type names plans an in-place update even though the steps are unchanged.",
+				},
 				"organization": {
-					Type:     cty.String,
-					Computed: true,
+					Type:        cty.String,
+					Optional:    true,
+					Computed:    true,
+					Description: "Slug of the organization to create the pipeline in. If not specified, then the organization slug configured in the provider is used.",
+
+					ValidateFn: func(val string) tfsdk.Diagnostics {
+						var diags tfsdk.Diagnostics
+						if val == "" {
+							diags = diags.Append(tfsdk.ValidationError(
+								fmt.Errorf("an organization slug must not be empty"),
+							))
+						}
+						return diags
+					},
 				},
 			},
 			NestedBlockTypes: map[string]*tfschema.NestedBlockType{
-				"step": {
-					Nesting: tfschema.NestingList,
-					Content: tfschema.BlockType{
-						Attributes: map[string]*tfschema.Attribute{
-							"type": {
-								Type:     cty.String,
-								Required: true,
-							},
-							"label": {
-								Type:     cty.String,
-								Optional: true,
-							},
-
-							// For "script" steps only
-							"command": {
-								Type:     cty.String,
-								Optional: true,
-							},
-							"env": {
-								Type:     cty.Map(cty.String),
-								Optional: true,
-							},
-							"agent_query_rules": {
-								Type:     cty.Set(cty.String),
-								Optional: true,
-							},
-						},
-					},
-				},
+				"provider_settings": pipelineProviderSettingsSchema(),
+				"notify":            pipelineNotifySchema(),
+				"step":              pipelineStepSchema(),
 			},
 		},
 		PlanFn: func(ctx context.Context, meta *Meta, plan tfobj.PlanBuilder) (cty.Value, cty.PathSet, tfsdk.Diagnostics) {
 			var diags tfsdk.Diagnostics
 
-			moreDiags := validateStepBlocks(plan.BlockList("step"))
-			diags = diags.Append(moreDiags.UnderPath(cty.GetAttrPath("step")))
+			diags = diags.Append(validatePipelineSettings(plan))
+			diags = diags.Append(validatePipelineProviderSettings(plan.ConfigReader()))
+
+			moreDiags := validateNotifyBlocks(plan.BlockList("notify"), pipelineNotifyKinds, "pipelines")
+			diags = diags.Append(moreDiags.UnderPath(cty.GetAttrPath("notify")))
+
+			// A pipeline's steps are defined either by steps_yaml or by step
+			// blocks, but not both. steps_yaml is also computed, so we must
+			// check the configuration to see whether it is set.
+			stepsFromYAML := !plan.ConfigReader().Attr("steps_yaml").IsNull()
+			if stepsYAMLVal := plan.Attr("steps_yaml"); stepsFromYAML {
+				if plan.BlockCount("step") != 0 {
+					diags = diags.Append(tfsdk.Diagnostic{
+						Severity: tfsdk.Error,
+						Summary:  "Conflicting pipeline steps",
+						Detail:   "A pipeline's steps must be defined either by the steps_yaml argument or by \"step\" blocks, but not both.",
+						Path:     cty.GetAttrPath("steps_yaml"),
+					})
+				}
+				if stepsYAMLVal.IsKnown() {
+					moreDiags = validateStepsYAML(stepsYAMLVal.AsString())
+					diags = diags.Append(moreDiags.UnderPath(cty.GetAttrPath("steps_yaml")))
+				}
+			} else {
+				moreDiags = resolveStepTypes(plan.BlockPlanBuilderList("step"))
+				diags = diags.Append(moreDiags.UnderPath(cty.GetAttrPath("step")))
+				moreDiags = validateStepBlocks(plan.BlockList("step"))
+				diags = diags.Append(moreDiags.UnderPath(cty.GetAttrPath("step")))
+			}
+
+			diags = diags.Append(planOrganization(meta, plan))
+			if diags.HasErrors() {
+				return plan.ObjectVal(), plan.RequiresReplace(), diags
+			}
+
+			if !stepsFromYAML {
+				plan.SetAttr("steps_yaml", planStepsYAML(plan.ObjectVal().GetAttr("step")))
+			}
 
-			newOrgSlug := cty.StringVal(*meta.org.Slug)
-			plan.SetAttr("organization", newOrgSlug)
-			if plan.Action() != tfobj.Create && plan.AttrHasChange("organization") {
-				plan.SetAttrRequiresReplacement("organization")
+			// Buildkite derives the slug from the name, so we can predict
+			// the slug and most of the URLs of a new pipeline. Renaming a
+			// pipeline may also change its slug and all of the URLs that
+			// contain it.
+			if plan.Action() == tfobj.Create {
+				planPipelineURLs(plan)
+			} else if attrHasChange(plan, "name") {
+				plan.SetAttrUnknown("slug")
+				plan.SetAttrUnknown("url")
+				plan.SetAttrUnknown("web_url")
+				plan.SetAttrUnknown("builds_url")
+				plan.SetAttrUnknown("badge_url")
 			}
 
 			return plan.ObjectVal(), plan.RequiresReplace(), diags
@@ -151,20 +277,68 @@ func pipelineManagedResourceType() tfsdk.ManagedResourceType {
 		CreateFn: func(ctx context.Context, meta *Meta, obj *pipelineMRT) (*pipelineMRT, tfsdk.Diagnostics) {
 			var diags tfsdk.Diagnostics
 
+			client, moreDiags := meta.apiClient()
+			diags = diags.Append(moreDiags)
+			_, moreDiags = meta.organization(*obj.Organization)
+			diags = diags.Append(moreDiags)
+			if diags.HasErrors() {
+				return obj, diags
+			}
+
 			pipeline := buildAPICreatePipelineFromMRT(obj)
-			created, resp, err := meta.client.Pipelines.Create(*meta.org.Slug, pipeline)
+			created, resp, err := createPipeline(client, *obj.Organization, pipeline)
+			if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity {
+				// Buildkite rejects a new pipeline whose slug is already
+				// taken, but it reports that in the same way as any other
+				// invalid request, so we check whether the slug exists.
+				if existing := findConflictingPipeline(client, obj); existing != nil {
+					slug := *existing.Slug
+					if obj.AdoptExisting == nil || !*obj.AdoptExisting {
+						diags = diags.Append(tfsdk.Diagnostic{
+							Severity: tfsdk.Error,
+							Summary:  "Buildkite pipeline already exists",
+							Detail:   fmt.Sprintf("Organization %q already has a pipeline with the slug %q. To manage the existing pipeline with Terraform, set adopt_existing = true to adopt it and update it to match this configuration.", *obj.Organization, slug),
+							Path:     cty.GetAttrPath("name"),
+						})
+						return obj, diags
+					}
+					log.Printf("[INFO] Adopting existing pipeline %q in organization %q", slug, *obj.Organization)
+					if existing.ArchivedAt != nil {
+						diags = diags.Append(setPipelineArchived(client, *obj.Organization, slug, false))
+						if diags.HasErrors() {
+							return obj, diags
+						}
+					}
+					created, resp, err = updatePipeline(client, *obj.Organization, slug, pipeline)
+				}
+			}
 			diags = diags.Append(apiWriteErrors(resp, err))
 			if diags.HasErrors() {
 				return obj, diags
 			}
 
-			return buildMRTPipelineFromAPI(created, meta.org), diags
+			ret := normalizeMRTPipelineEmpties(buildMRTPipelineFromAPI(created, *obj.Organization), obj)
+			diags = diags.Append(checkPlannedPipelineURLs(obj, ret))
+			if obj.Archived != nil && *obj.Archived {
+				diags = diags.Append(setPipelineArchived(client, *ret.Organization, *ret.Slug, true))
+				ret.Archived = obj.Archived
+			}
+			return ret, diags
 		},
 
 		ReadFn: func(ctx context.Context, meta *Meta, obj *pipelineMRT) (*pipelineMRT, tfsdk.Diagnostics) {
 			var diags tfsdk.Diagnostics
 
-			read, resp, err := meta.client.Pipelines.Get(*obj.Organization, *obj.Slug)
+			// We use the organization recorded in the state here, rather than
+			// the one in the provider configuration, so that refreshing can
+			// still work even if the configured organization is unavailable.
+			client, moreDiags := meta.apiClient()
+			diags = diags.Append(moreDiags)
+			if diags.HasErrors() {
+				return obj, diags
+			}
+
+			read, resp, err := getPipeline(client, *obj.Organization, *obj.Slug)
 			if resp != nil && resp.StatusCode == http.StatusNotFound {
 				return nil, diags
 			}
@@ -173,26 +347,70 @@ func pipelineManagedResourceType() tfsdk.ManagedResourceType {
 				return obj, diags
 			}
 
-			return buildMRTPipelineFromAPI(read, meta.org), diags
+			return normalizeMRTPipelineEmpties(buildMRTPipelineFromAPI(read, *obj.Organization), obj), diags
 		},
 
 		UpdateFn: func(ctx context.Context, meta *Meta, prior, new *pipelineMRT) (*pipelineMRT, tfsdk.Diagnostics) {
 			var diags tfsdk.Diagnostics
 
-			diags = diags.Append(tfsdk.Diagnostic{
-				Severity: tfsdk.Error,
-				Summary:  "Update not implemented",
-				Detail:   "Updating is not yet implemented for buildkite_pipeline.",
-			})
+			client, moreDiags := meta.apiClient()
+			diags = diags.Append(moreDiags)
+			if diags.HasErrors() {
+				return prior, diags
+			}
+
+			// Buildkite doesn't allow changes to archived pipelines, so we
+			// must unarchive the pipeline first even if it will be archived
+			// again afterwards.
+			if prior.Archived != nil && *prior.Archived {
+				diags = diags.Append(setPipelineArchived(client, *prior.Organization, *prior.Slug, false))
+				if diags.HasErrors() {
+					return prior, diags
+				}
+			}
 
-			return new, diags
+			// The update request is addressed using the prior slug, but the
+			// response may contain a new slug if the name has changed.
+			pipeline := buildAPICreatePipelineFromMRT(new)
+			updated, resp, err := updatePipeline(client, *prior.Organization, *prior.Slug, pipeline)
+			diags = diags.Append(apiWriteErrors(resp, err))
+			if diags.HasErrors() {
+				return prior, diags
+			}
+
+			ret := normalizeMRTPipelineEmpties(buildMRTPipelineFromAPI(updated, *prior.Organization), new)
+			if new.Archived != nil && *new.Archived {
+				diags = diags.Append(setPipelineArchived(client, *ret.Organization, *ret.Slug, true))
+				ret.Archived = new.Archived
+			}
+			return ret, diags
 		},
 
 		DeleteFn: func(ctx context.Context, meta *Meta, obj *pipelineMRT) (*pipelineMRT, tfsdk.Diagnostics) {
 			var diags tfsdk.Diagnostics
 
-			resp, err := meta.client.Pipelines.Delete(*obj.Organization, *obj.Slug)
-			diags = diags.Append(apiWriteErrors(resp, err))
+			client, moreDiags := meta.apiClient()
+			diags = diags.Append(moreDiags)
+			if diags.HasErrors() {
+				return obj, diags
+			}
+
+			if obj.DeletionProtection != nil && *obj.DeletionProtection {
+				diags = diags.Append(tfsdk.Diagnostic{
+					Severity: tfsdk.Error,
+					Summary:  "Pipeline is protected from deletion",
+					Detail:   fmt.Sprintf("Pipeline %q in organization %q has deletion_protection enabled. To destroy it, first set deletion_protection = false and apply that change.", *obj.Slug, *obj.Organization),
+					Path:     cty.GetAttrPath("deletion_protection"),
+				})
+				return obj, diags
+			}
+
+			if obj.OnDestroy == nil || *obj.OnDestroy == "delete" {
+				resp, err := client.Pipelines.Delete(*obj.Organization, *obj.Slug)
+				diags = diags.Append(apiWriteErrors(resp, err))
+			} else if obj.Archived == nil || !*obj.Archived {
+				diags = diags.Append(setPipelineArchived(client, *obj.Organization, *obj.Slug, true))
+			}
 			if diags.HasErrors() {
 				return obj, diags
 			}
@@ -202,31 +420,74 @@ func pipelineManagedResourceType() tfsdk.ManagedResourceType {
 	})
 }
 
-func buildAPICreatePipelineFromMRT(obj *pipelineMRT) *buildkite.CreatePipeline {
-	ret := &buildkite.CreatePipeline{
-		Name:       obj.Name,
-		Repository: obj.Repository,
-		Steps:      make([]buildkite.Step, 0, len(obj.Steps)),
+// findConflictingPipeline returns the existing pipeline that prevented the
+// given pipeline from being created, or nil if there is no such pipeline or
+// if the slug that Buildkite would assign to the new pipeline can't be
+// determined.
+func findConflictingPipeline(client *buildkite.Client, obj *pipelineMRT) *apiPipeline {
+	slug, ok := predictPipelineSlug(obj.Name)
+	if !ok {
+		return nil
 	}
 
-	for _, stepObj := range obj.Steps {
-		step := buildkite.Step{
-			Type:    &stepObj.Type,
-			Name:    stepObj.Label,
-			Command: stepObj.Command,
-		}
+	existing, resp, err := getPipeline(client, *obj.Organization, slug)
+	if err != nil || resp == nil || resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	return existing
+}
 
-		if stepObj.Env != nil {
-			step.Env = *stepObj.Env
-		}
+// setPipelineArchived archives or unarchives the pipeline with the given slug
+// in the given organization.
+func setPipelineArchived(client *buildkite.Client, org, slug string, archived bool) tfsdk.Diagnostics {
+	var resp *buildkite.Response
+	var err error
+	if archived {
+		log.Printf("[INFO] Archiving pipeline %q in organization %q", slug, org)
+		resp, err = archivePipeline(client, org, slug)
+	} else {
+		log.Printf("[INFO] Unarchiving pipeline %q in organization %q", slug, org)
+		resp, err = unarchivePipeline(client, org, slug)
+	}
+	return apiWriteErrors(resp, err)
+}
 
-		ret.Steps = append(ret.Steps, step)
+func buildAPICreatePipelineFromMRT(obj *pipelineMRT) *apiPipeline {
+	ret := &apiPipeline{
+		Name:       &obj.Name,
+		Repository: &obj.Repository,
+
+		// We send explicit empty values for any unset settings, so that
+		// removing one from the configuration resets it in Buildkite.
+		Description:                     stringOrEmpty(obj.Description),
+		DefaultBranch:                   stringOrEmpty(obj.DefaultBranch),
+		BranchConfiguration:             stringOrEmpty(obj.BranchConfiguration),
+		SkipQueuedBranchBuilds:          boolOrFalse(obj.SkipQueuedBranchBuilds),
+		SkipQueuedBranchBuildsFilter:    stringOrEmpty(obj.SkipQueuedBranchBuildsFilter),
+		CancelRunningBranchBuilds:       boolOrFalse(obj.CancelRunningBranchBuilds),
+		CancelRunningBranchBuildsFilter: stringOrEmpty(obj.CancelRunningBranchBuildsFilter),
+		DefaultTimeoutInMinutes:         obj.DefaultTimeoutInMinutes,
+		MaximumTimeoutInMinutes:         obj.MaximumTimeoutInMinutes,
+		Visibility:                      obj.Visibility,
+
+		ProviderSettings: buildAPIProviderSettingsFromMRT(obj.ProviderSettings),
+		Notify:           buildAPINotificationsFromMRT(obj.Notify),
+	}
+
+	if len(obj.Steps) == 0 && obj.StepsYAML != nil {
+		ret.Configuration = obj.StepsYAML
+	} else {
+		// Buildkite keeps using a pipeline's YAML configuration until it
+		// is cleared, so switching from steps_yaml to step blocks must
+		// explicitly remove it.
+		ret.Configuration = new(string)
+		ret.Steps = buildAPIStepsFromMRT(obj.Steps)
 	}
 
 	return ret
 }
 
-func buildMRTPipelineFromAPI(pipeline *buildkite.Pipeline, org *buildkite.Organization) *pipelineMRT {
+func buildMRTPipelineFromAPI(pipeline *apiPipeline, orgSlug string) *pipelineMRT {
 	ret := &pipelineMRT{
 		ID:         pipeline.ID,
 		URL:        pipeline.URL,
@@ -238,89 +499,203 @@ func buildMRTPipelineFromAPI(pipeline *buildkite.Pipeline, org *buildkite.Organi
 		BadgeURL:   pipeline.BadgeURL,
 		Steps:      make([]pipelineMRTStep, 0, len(pipeline.Steps)),
 
-		Organization: org.Slug,
+		// The API returns empty values for unset settings, which we represent
+		// as null here and then use normalizeMRTPipelineEmpties to reconcile
+		// with the configuration where needed.
+		Description:                     nonEmptyString(pipeline.Description),
+		DefaultBranch:                   nonEmptyString(pipeline.DefaultBranch),
+		BranchConfiguration:             nonEmptyString(pipeline.BranchConfiguration),
+		SkipQueuedBranchBuilds:          trueOrNil(pipeline.SkipQueuedBranchBuilds),
+		SkipQueuedBranchBuildsFilter:    nonEmptyString(pipeline.SkipQueuedBranchBuildsFilter),
+		CancelRunningBranchBuilds:       trueOrNil(pipeline.CancelRunningBranchBuilds),
+		CancelRunningBranchBuildsFilter: nonEmptyString(pipeline.CancelRunningBranchBuildsFilter),
+		DefaultTimeoutInMinutes:         nonZeroInt(pipeline.DefaultTimeoutInMinutes),
+		MaximumTimeoutInMinutes:         nonZeroInt(pipeline.MaximumTimeoutInMinutes),
+		Visibility:                      pipeline.Visibility,
+
+		Notify:    buildMRTNotifyFromAPI(pipeline.Notify),
+		StepsYAML: nonEmptyString(pipeline.Configuration),
+
+		Organization: &orgSlug,
+	}
+	if pipeline.ArchivedAt != nil {
+		archived := true
+		ret.Archived = &archived
 	}
 	createdTime := pipeline.CreatedAt.Format(timestampFormat)
 	ret.CreatedTime = &createdTime
 
+	if pipeline.Provider != nil {
+		ret.ProviderSettings = buildMRTProviderSettingsFromAPI(&pipeline.Provider.Settings)
+	}
+
 	for _, step := range pipeline.Steps {
-		step := pipelineMRTStep{
-			Type:    *step.Type,
-			Label:   step.Name,
-			Command: step.Command,
+		ret.Steps = append(ret.Steps, buildMRTStepFromAPI(step))
+	}
+	return ret
+}
+
+// normalizeMRTPipelineEmpties updates the given object, which was built from
+// an API response, so that any empty values that were represented as empty
+// rather than null in the given "want" object are empty rather than null in
+// the result too.
+//
+// The Buildkite API does not distinguish between null and empty values, so
+// this allows us to treat the two as equivalent without producing spurious
+// diffs.
+func normalizeMRTPipelineEmpties(got, want *pipelineMRT) *pipelineMRT {
+	// These arguments affect only how Terraform creates and destroys the
+	// pipeline, so they are not recorded in Buildkite.
+	got.AdoptExisting = want.AdoptExisting
+	got.DeletionProtection = want.DeletionProtection
+	got.OnDestroy = want.OnDestroy
+	normalizeFalse(&got.Archived, want.Archived)
+
+	normalizeEmptyString(&got.Description, want.Description)
+	normalizeEmptyString(&got.DefaultBranch, want.DefaultBranch)
+	normalizeEmptyString(&got.BranchConfiguration, want.BranchConfiguration)
+	normalizeFalse(&got.SkipQueuedBranchBuilds, want.SkipQueuedBranchBuilds)
+	normalizeEmptyString(&got.SkipQueuedBranchBuildsFilter, want.SkipQueuedBranchBuildsFilter)
+	normalizeFalse(&got.CancelRunningBranchBuilds, want.CancelRunningBranchBuilds)
+	normalizeEmptyString(&got.CancelRunningBranchBuildsFilter, want.CancelRunningBranchBuildsFilter)
+
+	// Buildkite always returns provider settings, but we only track them
+	// if the configuration includes a provider_settings block.
+	if want.ProviderSettings == nil {
+		got.ProviderSettings = nil
+	}
+
+	// Buildkite returns both the YAML configuration and the steps derived
+	// from it, so we keep only the one that the configuration uses. If the
+	// configuration uses step blocks then steps_yaml is instead derived from
+	// those blocks, and so must be updated after we've normalized them.
+	if len(want.Steps) == 0 && want.StepsYAML != nil {
+		got.Steps = got.Steps[:0]
+		if got.StepsYAML != nil && stepsYAMLEquivalent(*got.StepsYAML, *want.StepsYAML) {
+			got.StepsYAML = want.StepsYAML
 		}
+		return got
+	}
 
-		// TODO: Env and AgentQueryRules
+	for i := range got.Steps {
+		if i >= len(want.Steps) {
+			break
+		}
+		normalizeMRTStepEmpties(&got.Steps[i], &want.Steps[i])
+	}
+	got.StepsYAML = renderStepsYAML(got.Steps)
+	return got
+}
 
-		ret.Steps = append(ret.Steps, step)
+func normalizeEmptyString(got **string, want *string) {
+	if *got == nil && want != nil && *want == "" {
+		*got = want
 	}
-	return ret
 }
 
-func validateStepBlocks(readers []tfobj.ObjectReader) tfsdk.Diagnostics {
-	var diags tfsdk.Diagnostics
+func normalizeFalse(got **bool, want *bool) {
+	if *got == nil && want != nil && !*want {
+		*got = want
+	}
+}
 
-	if len(readers) == 0 {
-		diags = diags.Append(tfsdk.Diagnostic{
-			Severity: tfsdk.Error,
-			Summary:  "No Buildkite pipeline steps",
-			Detail:   "A Buildkite pipeline must have at least one \"step\" block.",
-		})
+func normalizeZeroInt(got **int, want *int) {
+	if *got == nil && want != nil && *want == 0 {
+		*got = want
 	}
+}
 
-	for i, reader := range readers {
-		moreDiags := validateStepBlock(reader)
-		diags = diags.Append(moreDiags.UnderPath(cty.IndexPath(cty.NumberIntVal(int64(i)))))
+func stringOrEmpty(s *string) *string {
+	if s == nil {
+		return new(string)
 	}
+	return s
+}
 
-	return diags
+func boolOrFalse(b *bool) *bool {
+	if b == nil {
+		return new(bool)
+	}
+	return b
 }
 
-func validateStepBlock(reader tfobj.ObjectReader) tfsdk.Diagnostics {
-	var diags tfsdk.Diagnostics
+func nonEmptyString(s *string) *string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return s
+}
 
-	stepTypeVal := reader.Attr("type")
-	if !stepTypeVal.IsKnown() {
-		// Can't validate at all yet, then
-		return diags
+func trueOrNil(b *bool) *bool {
+	if b == nil || !*b {
+		return nil
 	}
-	switch stepType := stepTypeVal.AsString(); stepType {
+	return b
+}
 
-	case "script":
-		if reader.Attr("command").IsNull() {
-			diags = diags.Append(tfsdk.ValidationError(fmt.Errorf("\"command\" argument is required for %q steps", stepType)))
-		}
+func nonZeroInt(n *int) *int {
+	if n == nil || *n == 0 {
+		return nil
+	}
+	return n
+}
 
-	case "trigger":
-		if !reader.Attr("command").IsNull() {
-			diags = diags.Append(tfsdk.ValidationError(
-				cty.GetAttrPath("command").NewErrorf("\"command\" is not used for %q steps", stepType),
-			))
-		}
+// attrHasChange returns true if the given attribute has a different value in
+// the plan than it had in the prior state.
+//
+// This is here because tfobj.PlanReader.AttrHasChange currently returns the
+// opposite of what its name suggests.
+func attrHasChange(plan tfobj.PlanReader, name string) bool {
+	prior, planned := plan.AttrChange(name)
+	eqV := planned.Equals(prior)
+	if !eqV.IsKnown() {
+		return true
+	}
+	return eqV.False()
+}
 
-	case "manual":
-		if !reader.Attr("command").IsNull() {
-			diags = diags.Append(tfsdk.ValidationError(
-				cty.GetAttrPath("command").NewErrorf("\"command\" is not used for %q steps", stepType),
-			))
+func validatePipelineSettings(reader tfobj.ObjectReader) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	for _, name := range []string{"skip_queued_branch_builds", "cancel_running_branch_builds"} {
+		filterName := name + "_filter"
+		enabled := reader.Attr(name)
+		filter := reader.Attr(filterName)
+		if !enabled.IsKnown() || !filter.IsKnown() || filter.IsNull() {
+			continue
+		}
+		if enabled.IsNull() || enabled.False() {
+			diags = diags.Append(tfsdk.Diagnostic{
+				Severity: tfsdk.Error,
+				Summary:  "Invalid pipeline settings",
+				Detail:   fmt.Sprintf("The %q argument can be used only when %q is set to true.", filterName, name),
+				Path:     cty.GetAttrPath(filterName),
+			})
 		}
+	}
 
-	case "waiter":
-		if !reader.Attr("command").IsNull() {
-			diags = diags.Append(tfsdk.ValidationError(
-				cty.GetAttrPath("command").NewErrorf("\"command\" is not used for %q steps", stepType),
-			))
+	defaultTimeout := reader.Attr("default_timeout_in_minutes")
+	maxTimeout := reader.Attr("maximum_timeout_in_minutes")
+	if defaultTimeout.IsKnown() && !defaultTimeout.IsNull() && maxTimeout.IsKnown() && !maxTimeout.IsNull() {
+		if defaultTimeout.GreaterThan(maxTimeout).True() {
+			diags = diags.Append(tfsdk.Diagnostic{
+				Severity: tfsdk.Error,
+				Summary:  "Invalid pipeline settings",
+				Detail:   "The default timeout must not be greater than the maximum timeout.",
+				Path:     cty.GetAttrPath("default_timeout_in_minutes"),
+			})
 		}
+	}
 
-	case "":
-		diags = diags.Append(tfsdk.ValidationError(
-			cty.GetAttrPath("type").NewErrorf("empty string is not a valid step type"),
-		))
-	default:
+	return diags
+}
+
+func validateTimeoutInMinutes(val int) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+	if val < 1 {
 		diags = diags.Append(tfsdk.ValidationError(
-			cty.GetAttrPath("type").NewErrorf("%q is not a valid step type", stepType),
+			fmt.Errorf("a timeout must be at least one minute"),
 		))
 	}
-
 	return diags
 }
@@ -0,0 +1,197 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tfsdk "github.com/apparentlymart/terraform-sdk"
+	"github.com/apparentlymart/terraform-sdk/tfobj"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// stepGraphNode is a step within the dependency graph that validateStepGraph
+// checks.
+type stepGraphNode struct {
+	path     cty.Path
+	key      string // empty if the step has no key, or it is unknown
+	deps     []stepGraphDep
+	group    *stepGraphNode   // the group step containing this one, if any
+	children []*stepGraphNode // the steps inside this one, if it's a group
+}
+
+// stepGraphDep is a single entry in a step's depends_on blocks.
+type stepGraphDep struct {
+	path   cty.Path
+	target string
+}
+
+// stepGraphEdge is a resolved dependency between two steps, including the
+// implied dependencies between group steps and their children.
+type stepGraphEdge struct {
+	path cty.Path // the depends_on block that caused this edge
+	to   *stepGraphNode
+}
+
+// validateStepGraph checks that the step keys are unique and that the
+// depends_on blocks of the given steps, and the steps nested inside any
+// groups, refer to keys that exist and don't create any dependency cycles.
+//
+// The diagnostics it returns have paths relative to the list of step blocks.
+// Steps whose keys or dependencies are not yet known are skipped, so the
+// result may be incomplete during planning.
+func validateStepGraph(readers []tfobj.ObjectReader) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	var nodes []*stepGraphNode
+	for i, reader := range readers {
+		node := stepGraphNodeFromReader(reader, cty.IndexPath(cty.NumberIntVal(int64(i))))
+		nodes = append(nodes, node)
+
+		if typeVal := reader.Attr("type"); !typeVal.IsKnown() || typeVal.AsString() != "group" {
+			continue
+		}
+		for j, childReader := range reader.BlockList("step") {
+			child := stepGraphNodeFromReader(childReader, node.path.Copy().GetAttr("step").Index(cty.NumberIntVal(int64(j))))
+			child.group = node
+			node.children = append(node.children, child)
+			nodes = append(nodes, child)
+		}
+	}
+
+	byKey := make(map[string]*stepGraphNode)
+	for _, node := range nodes {
+		if node.key == "" {
+			continue
+		}
+		if existing, exists := byKey[node.key]; exists {
+			diags = diags.Append(tfsdk.Diagnostic{
+				Severity: tfsdk.Error,
+				Summary:  "Duplicate step key",
+				Detail:   fmt.Sprintf("The key %q is already used by %s. Each step in a pipeline must have a unique key.", node.key, formatStepPath(existing.path)),
+				Path:     node.path.Copy().GetAttr("key"),
+			})
+			continue
+		}
+		byKey[node.key] = node
+	}
+
+	// A group step doesn't complete until all of its children have, and
+	// its children don't start until the group's own dependencies have
+	// completed, so we add edges to represent both of those.
+	edges := make(map[*stepGraphNode][]stepGraphEdge, len(nodes))
+	for _, node := range nodes {
+		for _, dep := range node.deps {
+			target, exists := byKey[dep.target]
+			if !exists {
+				diags = diags.Append(tfsdk.Diagnostic{
+					Severity: tfsdk.Error,
+					Summary:  "Reference to undefined step",
+					Detail:   fmt.Sprintf("No step in this pipeline has the key %q.", dep.target),
+					Path:     dep.path,
+				})
+				continue
+			}
+			edges[node] = append(edges[node], stepGraphEdge{path: dep.path, to: target})
+			for _, child := range node.children {
+				edges[child] = append(edges[child], stepGraphEdge{path: dep.path, to: target})
+			}
+		}
+		for _, child := range node.children {
+			edges[node] = append(edges[node], stepGraphEdge{path: child.path, to: child})
+		}
+	}
+
+	// We use the classic three-color depth-first search to find cycles,
+	// reporting each one at the dependency that closes it.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[*stepGraphNode]int, len(nodes))
+	var stack []*stepGraphNode
+	var visit func(node *stepGraphNode)
+	visit = func(node *stepGraphNode) {
+		state[node] = visiting
+		stack = append(stack, node)
+		for _, edge := range edges[node] {
+			switch state[edge.to] {
+			case unvisited:
+				visit(edge.to)
+			case visiting:
+				var cycle []string
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == edge.to {
+						for _, n := range stack[i:] {
+							cycle = append(cycle, n.displayName())
+						}
+						break
+					}
+				}
+				cycle = append(cycle, edge.to.displayName())
+				diags = diags.Append(tfsdk.Diagnostic{
+					Severity: tfsdk.Error,
+					Summary:  "Step dependency cycle",
+					Detail:   "The dependencies of this pipeline's steps form a cycle: " + strings.Join(cycle, " → ") + ".",
+					Path:     edge.path,
+				})
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[node] = visited
+	}
+	for _, node := range nodes {
+		if state[node] == unvisited {
+			visit(node)
+		}
+	}
+
+	return diags
+}
+
+func stepGraphNodeFromReader(reader tfobj.ObjectReader, path cty.Path) *stepGraphNode {
+	node := &stepGraphNode{path: path}
+	if keyVal := reader.Attr("key"); keyVal.IsKnown() && !keyVal.IsNull() {
+		node.key = keyVal.AsString()
+	}
+	for i, depReader := range reader.BlockList("depends_on") {
+		targetVal := depReader.Attr("step")
+		if !targetVal.IsKnown() || targetVal.IsNull() {
+			continue
+		}
+		node.deps = append(node.deps, stepGraphDep{
+			path:   path.Copy().GetAttr("depends_on").Index(cty.NumberIntVal(int64(i))).GetAttr("step"),
+			target: targetVal.AsString(),
+		})
+	}
+	return node
+}
+
+// displayName returns a name for the receiving step for use in diagnostic
+// messages: its quoted key if it has one, or its path otherwise.
+func (n *stepGraphNode) displayName() string {
+	if n.key != "" {
+		return strconv.Quote(n.key)
+	}
+	return formatStepPath(n.path)
+}
+
+// formatStepPath returns a string representation of a path relative to the
+// list of step blocks, like "step[2]", for use in diagnostic messages.
+func formatStepPath(path cty.Path) string {
+	var buf strings.Builder
+	buf.WriteString("step")
+	for _, step := range path {
+		switch step := step.(type) {
+		case cty.IndexStep:
+			if step.Key.Type() == cty.Number {
+				bf := step.Key.AsBigFloat()
+				buf.WriteString("[" + bf.Text('f', 0) + "]")
+			}
+		case cty.GetAttrStep:
+			buf.WriteString("." + step.Name)
+		}
+	}
+	return buf.String()
+}
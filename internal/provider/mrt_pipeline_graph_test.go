@@ -0,0 +1,203 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apparentlymart/terraform-sdk/tfobj"
+	"github.com/apparentlymart/terraform-sdk/tfschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestValidateStepGraph(t *testing.T) {
+	schema := &pipelineStepSchema().Content
+	childSchema := &schema.NestedBlockTypes["step"].Content
+	depSchema := &schema.NestedBlockTypes["depends_on"].Content
+
+	// step returns a step block value with the given type, key and
+	// dependencies, and with any other arguments null.
+	step := func(schema *tfschema.BlockType, typ, key string, deps []string, children ...cty.Value) cty.Value {
+		attrs := map[string]cty.Value{"type": cty.StringVal(typ)}
+		if key != "" {
+			attrs["key"] = cty.StringVal(key)
+		}
+		if len(deps) != 0 {
+			var depVals []cty.Value
+			for _, dep := range deps {
+				depVals = append(depVals, testObjectVal(depSchema, map[string]cty.Value{
+					"step": cty.StringVal(dep),
+				}))
+			}
+			attrs["depends_on"] = cty.ListVal(depVals)
+		}
+		if len(children) != 0 {
+			attrs["step"] = cty.ListVal(children)
+		}
+		return testObjectVal(schema, attrs)
+	}
+	command := func(key string, deps ...string) cty.Value {
+		return step(schema, "command", key, deps)
+	}
+	child := func(key string, deps ...string) cty.Value {
+		return step(childSchema, "command", key, deps)
+	}
+	group := func(key string, deps []string, children ...cty.Value) cty.Value {
+		return step(schema, "group", key, deps, children...)
+	}
+
+	type wantDiag struct {
+		summary, detail string
+		path            cty.Path
+	}
+	tests := map[string]struct {
+		steps []cty.Value
+		want  []wantDiag
+	}{
+		"no dependencies": {
+			[]cty.Value{command(""), command("")},
+			nil,
+		},
+		"valid dependencies": {
+			[]cty.Value{
+				command("build"),
+				group("checks", []string{"build"},
+					child("lint"),
+					child("test", "lint"),
+				),
+				command("deploy", "checks", "test"),
+			},
+			nil,
+		},
+		"duplicate key": {
+			[]cty.Value{command("build"), command("build")},
+			[]wantDiag{{
+				"Duplicate step key",
+				`The key "build" is already used by step[0]. Each step in a pipeline must have a unique key.`,
+				cty.IndexPath(cty.NumberIntVal(1)).GetAttr("key"),
+			}},
+		},
+		"duplicate key in group": {
+			[]cty.Value{
+				group("", nil, child("build")),
+				command("build"),
+			},
+			[]wantDiag{{
+				"Duplicate step key",
+				`The key "build" is already used by step[0].step[0]. Each step in a pipeline must have a unique key.`,
+				cty.IndexPath(cty.NumberIntVal(1)).GetAttr("key"),
+			}},
+		},
+		"undefined reference": {
+			[]cty.Value{command("build", "missing")},
+			[]wantDiag{{
+				"Reference to undefined step",
+				`No step in this pipeline has the key "missing".`,
+				cty.IndexPath(cty.NumberIntVal(0)).GetAttr("depends_on").Index(cty.NumberIntVal(0)).GetAttr("step"),
+			}},
+		},
+		"self dependency": {
+			[]cty.Value{command("build", "build")},
+			[]wantDiag{{
+				"Step dependency cycle",
+				`The dependencies of this pipeline's steps form a cycle: "build" → "build".`,
+				cty.IndexPath(cty.NumberIntVal(0)).GetAttr("depends_on").Index(cty.NumberIntVal(0)).GetAttr("step"),
+			}},
+		},
+		"cycle": {
+			[]cty.Value{
+				command("a", "c"),
+				command("b", "a"),
+				command("c", "b"),
+			},
+			[]wantDiag{{
+				"Step dependency cycle",
+				`The dependencies of this pipeline's steps form a cycle: "a" → "c" → "b" → "a".`,
+				cty.IndexPath(cty.NumberIntVal(1)).GetAttr("depends_on").Index(cty.NumberIntVal(0)).GetAttr("step"),
+			}},
+		},
+		"child depends on its group": {
+			[]cty.Value{
+				group("checks", nil, child("lint", "checks")),
+			},
+			[]wantDiag{{
+				"Step dependency cycle",
+				`The dependencies of this pipeline's steps form a cycle: "checks" → "lint" → "checks".`,
+				cty.IndexPath(cty.NumberIntVal(0)).GetAttr("step").Index(cty.NumberIntVal(0)).GetAttr("depends_on").Index(cty.NumberIntVal(0)).GetAttr("step"),
+			}},
+		},
+		"cycle through a group": {
+			[]cty.Value{
+				group("", []string{"deploy"}, child("test")),
+				command("deploy", "test"),
+			},
+			[]wantDiag{{
+				"Step dependency cycle",
+				`The dependencies of this pipeline's steps form a cycle: "deploy" → "test" → "deploy".`,
+				cty.IndexPath(cty.NumberIntVal(0)).GetAttr("depends_on").Index(cty.NumberIntVal(0)).GetAttr("step"),
+			}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var readers []tfobj.ObjectReader
+			for _, v := range test.steps {
+				readers = append(readers, tfobj.NewObjectReader(schema, v))
+			}
+
+			diags := validateStepGraph(readers)
+			if len(diags) != len(test.want) {
+				t.Fatalf("wrong number of diagnostics\ngot:  %#v\nwant: %d", diags, len(test.want))
+			}
+			for i, want := range test.want {
+				got := diags[i]
+				if got.Summary != want.summary {
+					t.Errorf("wrong summary for diagnostic %d\ngot:  %s\nwant: %s", i, got.Summary, want.summary)
+				}
+				if got.Detail != want.detail {
+					t.Errorf("wrong detail for diagnostic %d\ngot:  %s\nwant: %s", i, got.Detail, want.detail)
+				}
+				if !reflect.DeepEqual(got.Path, want.path) {
+					t.Errorf("wrong path for diagnostic %d\ngot:  %s\nwant: %s", i, formatStepPath(got.Path), formatStepPath(want.path))
+				}
+			}
+		})
+	}
+}
+
+func TestFormatStepPath(t *testing.T) {
+	tests := []struct {
+		path cty.Path
+		want string
+	}{
+		{nil, "step"},
+		{cty.IndexPath(cty.NumberIntVal(2)), "step[2]"},
+		{cty.IndexPath(cty.NumberIntVal(0)).GetAttr("key"), "step[0].key"},
+		{
+			cty.IndexPath(cty.NumberIntVal(1)).GetAttr("step").Index(cty.NumberIntVal(3)).GetAttr("depends_on").Index(cty.NumberIntVal(0)).GetAttr("step"),
+			"step[1].step[3].depends_on[0].step",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			if got := formatStepPath(test.path); got != test.want {
+				t.Errorf("wrong result\ngot:  %s\nwant: %s", got, test.want)
+			}
+		})
+	}
+}
+
+// testObjectVal returns an object value conforming to the given schema, with
+// the given attribute values and with all of the others null.
+func testObjectVal(schema *tfschema.BlockType, attrs map[string]cty.Value) cty.Value {
+	vals := make(map[string]cty.Value)
+	for name, ty := range schema.ImpliedCtyType().AttributeTypes() {
+		if v, exists := attrs[name]; exists {
+			vals[name] = v
+		} else {
+			vals[name] = cty.NullVal(ty)
+		}
+	}
+	return cty.ObjectVal(vals)
+}
@@ -0,0 +1,276 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+
+	tfsdk "github.com/apparentlymart/terraform-sdk"
+	"github.com/apparentlymart/terraform-sdk/tfobj"
+	"github.com/apparentlymart/terraform-sdk/tfschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type pipelineMRTStepMatrix struct {
+	Values      *[]string                     `cty:"values"`
+	Setup       *map[string][]string          `cty:"setup"`
+	Adjustments []pipelineMRTMatrixAdjustment `cty:"adjustment"`
+}
+
+type pipelineMRTMatrixAdjustment struct {
+	With     map[string]string `cty:"with"`
+	Skip     *string           `cty:"skip"`
+	SoftFail *bool             `cty:"soft_fail"`
+}
+
+// matrixRefPattern matches the interpolation sequences that the Buildkite
+// agent replaces with matrix values, capturing the dimension name if any.
+var matrixRefPattern = regexp.MustCompile(`\{\{\s*matrix(?:\.([^\s}]*))?\s*\}\}`)
+
+// pipelineStepMatrixSchema returns the schema for the "matrix" nested block
+// type within a step block.
+func pipelineStepMatrixSchema() *tfschema.NestedBlockType {
+	return &tfschema.NestedBlockType{
+		Nesting: tfschema.NestingSingle,
+		Content: tfschema.BlockType{
+			Attributes: map[string]*tfschema.Attribute{
+				"values": {
+					Type:        cty.List(cty.String),
+					Optional:    true,
+					Description: "Values of a single anonymous dimension, referenced as {{matrix}}. Cannot be used together with setup.",
+				},
+				"setup": {
+					Type:        cty.Map(cty.List(cty.String)),
+					Optional:    true,
+					Description: "Values of each of several named dimensions, referenced as {{matrix.NAME}}. Cannot be used together with values.",
+				},
+			},
+			NestedBlockTypes: map[string]*tfschema.NestedBlockType{
+				"adjustment": {
+					Nesting: tfschema.NestingList,
+					Content: tfschema.BlockType{
+						Attributes: map[string]*tfschema.Attribute{
+							"with": {
+								Type:        cty.Map(cty.String),
+								Required:    true,
+								Description: "Values of each dimension identifying the combination to adjust, which may be one not otherwise in the matrix.",
+							},
+							"skip": {
+								Type:        cty.String,
+								Optional:    true,
+								Description: "Either true to skip the combination, or a reason for skipping it to show in the Buildkite UI.",
+							},
+							"soft_fail": {
+								Type:        cty.Bool,
+								Optional:    true,
+								Description: "If true, a failure of the combination does not fail the build.",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// validateStepMatrix checks the "matrix" block of a step, if any, and checks
+// that all of the matrix references in the step's arguments are consistent
+// with it. The diagnostics it returns have paths relative to the step block.
+func validateStepMatrix(reader tfobj.ObjectReader) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	hasMatrix := reader.BlockCount("matrix") != 0
+	simple := false
+	var dims map[string]struct{}
+	if hasMatrix {
+		matrix := reader.BlockSingle("matrix")
+		path := cty.GetAttrPath("matrix")
+		valuesVal, setupVal := matrix.Attr("values"), matrix.Attr("setup")
+
+		switch {
+		case !valuesVal.IsNull() && !setupVal.IsNull():
+			diags = diags.Append(stepArgumentError(path, "only one of \"values\" or \"setup\" may be set"))
+			return diags
+		case valuesVal.IsNull() && setupVal.IsNull():
+			diags = diags.Append(stepArgumentError(path, "one of \"values\" or \"setup\" must be set"))
+			return diags
+
+		case !valuesVal.IsNull():
+			simple = true
+			if valuesVal.IsKnown() && valuesVal.LengthInt() == 0 {
+				diags = diags.Append(stepArgumentError(path.GetAttr("values"), "must have at least one value"))
+			}
+			if matrix.BlockCount("adjustment") != 0 {
+				diags = diags.Append(stepArgumentError(path.GetAttr("adjustment"), "adjustments can be used only with a matrix that has a \"setup\" argument"))
+			}
+
+		default:
+			if !setupVal.IsKnown() {
+				// Can't check the references until we know the dimensions.
+				return diags
+			}
+			if setupVal.LengthInt() == 0 {
+				diags = diags.Append(stepArgumentError(path.GetAttr("setup"), "must have at least one dimension"))
+			}
+			dims = make(map[string]struct{}, setupVal.LengthInt())
+			for it := setupVal.ElementIterator(); it.Next(); {
+				k, v := it.Element()
+				dims[k.AsString()] = struct{}{}
+				if v.IsKnown() && !v.IsNull() && v.LengthInt() == 0 {
+					diags = diags.Append(stepArgumentError(path.GetAttr("setup").Index(k), "dimension %q must have at least one value", k.AsString()))
+				}
+			}
+			for i, adjReader := range matrix.BlockList("adjustment") {
+				withVal := adjReader.Attr("with")
+				if !withVal.IsKnown() || withVal.IsNull() {
+					continue
+				}
+				for it := withVal.ElementIterator(); it.Next(); {
+					k, _ := it.Element()
+					if _, exists := dims[k.AsString()]; !exists {
+						diags = diags.Append(stepArgumentError(path.GetAttr("adjustment").Index(cty.NumberIntVal(int64(i))).GetAttr("with"), "%q is not a dimension of this matrix", k.AsString()))
+					}
+				}
+			}
+		}
+
+		if !reader.Attr("parallelism").IsNull() {
+			diags = diags.Append(tfsdk.ValidationError(
+				cty.GetAttrPath("parallelism").NewErrorf("\"parallelism\" cannot be used together with a matrix"),
+			))
+		}
+	}
+
+	checkRefs := func(path cty.Path, s string) {
+		for _, match := range matrixRefPattern.FindAllStringSubmatch(s, -1) {
+			ref, dim := match[0], match[1]
+			var detail string
+			switch {
+			case !hasMatrix:
+				detail = fmt.Sprintf("The reference %s is invalid because this step has no \"matrix\" block.", ref)
+			case simple && dim != "":
+				detail = fmt.Sprintf("The reference %s is invalid because this step's matrix has only a single anonymous dimension. Use {{matrix}} to refer to its value.", ref)
+			case !simple && dim == "":
+				detail = fmt.Sprintf("The reference %s is invalid because this step's matrix has named dimensions. Use {{matrix.NAME}} to refer to the value of one of them.", ref)
+			case !simple:
+				if _, exists := dims[dim]; !exists {
+					detail = fmt.Sprintf("The reference %s is invalid because this step's matrix has no dimension named %q.", ref, dim)
+				}
+			}
+			if detail != "" {
+				diags = diags.Append(tfsdk.Diagnostic{
+					Severity: tfsdk.Error,
+					Summary:  "Invalid matrix reference",
+					Detail:   detail,
+					Path:     path,
+				})
+			}
+		}
+	}
+	for _, name := range []string{"command", "label"} {
+		if v := reader.Attr(name); v.IsKnown() && !v.IsNull() {
+			checkRefs(cty.GetAttrPath(name), v.AsString())
+		}
+	}
+	if v := reader.Attr("commands"); v.IsKnown() && !v.IsNull() {
+		for it := v.ElementIterator(); it.Next(); {
+			idx, command := it.Element()
+			if command.IsKnown() && !command.IsNull() {
+				checkRefs(cty.GetAttrPath("commands").Index(idx), command.AsString())
+			}
+		}
+	}
+	if v := reader.Attr("agents"); v.IsKnown() && !v.IsNull() {
+		for it := v.ElementIterator(); it.Next(); {
+			key, tag := it.Element()
+			if tag.IsKnown() && !tag.IsNull() {
+				checkRefs(cty.GetAttrPath("agents").Index(key), tag.AsString())
+			}
+		}
+	}
+	if v := reader.Attr("agent_query_rules"); v.IsKnown() && !v.IsNull() {
+		for it := v.ElementIterator(); it.Next(); {
+			_, rule := it.Element()
+			if rule.IsKnown() && !rule.IsNull() {
+				checkRefs(cty.GetAttrPath("agent_query_rules"), rule.AsString())
+			}
+		}
+	}
+	for i, pluginReader := range reader.BlockList("plugin") {
+		if v := pluginReader.Attr("config"); v.IsKnown() && !v.IsNull() {
+			checkRefs(cty.GetAttrPath("plugin").Index(cty.NumberIntVal(int64(i))).GetAttr("config"), v.AsString())
+		}
+	}
+
+	return diags
+}
+
+func buildAPIMatrixFromMRT(obj *pipelineMRTStepMatrix) *apiMatrix {
+	if obj == nil {
+		return nil
+	}
+
+	ret := &apiMatrix{}
+	if obj.Values != nil {
+		ret.Values = *obj.Values
+	}
+	if obj.Setup != nil {
+		ret.Setup = *obj.Setup
+	}
+	for _, adjObj := range obj.Adjustments {
+		adj := &apiMatrixAdjustment{
+			With: adjObj.With,
+			Skip: buildAPISkipFromMRT(adjObj.Skip),
+		}
+		if adjObj.SoftFail != nil {
+			adj.SoftFail = &apiSoftFail{All: *adjObj.SoftFail}
+		}
+		ret.Adjustments = append(ret.Adjustments, adj)
+	}
+	return ret
+}
+
+func buildMRTMatrixFromAPI(matrix *apiMatrix) *pipelineMRTStepMatrix {
+	if matrix == nil {
+		return nil
+	}
+
+	ret := &pipelineMRTStepMatrix{
+		Adjustments: make([]pipelineMRTMatrixAdjustment, 0, len(matrix.Adjustments)),
+	}
+	if matrix.Setup != nil {
+		setup := matrix.Setup
+		ret.Setup = &setup
+	} else {
+		values := matrix.Values
+		if values == nil {
+			values = []string{}
+		}
+		ret.Values = &values
+	}
+	for _, adj := range matrix.Adjustments {
+		adjObj := pipelineMRTMatrixAdjustment{
+			With: adj.With,
+			Skip: buildMRTSkipFromAPI(adj.Skip),
+		}
+		if adj.SoftFail != nil && adj.SoftFail.All {
+			adjObj.SoftFail = &adj.SoftFail.All
+		}
+		ret.Adjustments = append(ret.Adjustments, adjObj)
+	}
+	return ret
+}
+
+// normalizeMRTMatrixEmpties is the equivalent of normalizeMRTStepEmpties for
+// a step's matrix block, which it updates in-place.
+func normalizeMRTMatrixEmpties(got, want *pipelineMRTStepMatrix) {
+	if got == nil || want == nil {
+		return
+	}
+	for i := range got.Adjustments {
+		if i >= len(want.Adjustments) {
+			break
+		}
+		normalizeSkip(&got.Adjustments[i].Skip, want.Adjustments[i].Skip)
+		normalizeFalse(&got.Adjustments[i].SoftFail, want.Adjustments[i].SoftFail)
+	}
+}
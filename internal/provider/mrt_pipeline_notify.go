@@ -0,0 +1,221 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	tfsdk "github.com/apparentlymart/terraform-sdk"
+	"github.com/apparentlymart/terraform-sdk/tfobj"
+	"github.com/apparentlymart/terraform-sdk/tfschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type pipelineMRTNotify struct {
+	Email                *string                              `cty:"email"`
+	BasecampCampfire     *string                              `cty:"basecamp_campfire"`
+	Slack                *pipelineMRTSlackNotify              `cty:"slack"`
+	Webhook              *string                              `cty:"webhook"`
+	PagerdutyChangeEvent *string                              `cty:"pagerduty_change_event"`
+	GitHubCommitStatus   *pipelineMRTGitHubCommitStatusNotify `cty:"github_commit_status"`
+	If                   *string                              `cty:"if"`
+}
+
+type pipelineMRTSlackNotify struct {
+	Channels []string `cty:"channels"`
+	Message  *string  `cty:"message"`
+}
+
+type pipelineMRTGitHubCommitStatusNotify struct {
+	Context *string `cty:"context"`
+}
+
+// These are the names of the arguments and nested block types in a "notify"
+// block that select the kind of notification. Each notify block must set
+// exactly one of them.
+var (
+	pipelineNotifyKinds = []string{
+		"email", "basecamp_campfire", "slack", "webhook",
+		"pagerduty_change_event", "github_commit_status",
+	}
+	stepNotifyKinds = []string{
+		"basecamp_campfire", "slack", "github_commit_status",
+	}
+)
+
+// pipelineNotifySchema returns the schema for the "notify" nested block type,
+// which is used both for the pipeline as a whole and for individual steps.
+//
+// Not all kinds of notification are valid for steps, so callers must use
+// validateNotifyBlocks to check that only suitable ones are used.
+func pipelineNotifySchema() *tfschema.NestedBlockType {
+	return &tfschema.NestedBlockType{
+		Nesting: tfschema.NestingList,
+		Content: tfschema.BlockType{
+			Attributes: map[string]*tfschema.Attribute{
+				"email": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Email address to notify.",
+				},
+				"basecamp_campfire": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Basecamp Campfire chatbot URL to post to.",
+				},
+				"webhook": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "URL to send webhook events to.",
+				},
+				"pagerduty_change_event": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "PagerDuty integration key to send change events to.",
+				},
+				"if": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Conditional expression that determines whether the notification is sent.",
+				},
+			},
+			NestedBlockTypes: map[string]*tfschema.NestedBlockType{
+				"slack": {
+					Nesting: tfschema.NestingSingle,
+					Content: tfschema.BlockType{
+						Attributes: map[string]*tfschema.Attribute{
+							"channels": {
+								Type:        cty.List(cty.String),
+								Required:    true,
+								Description: "Slack channels or users to notify, like \"#deploys\" or \"@someone\".",
+							},
+							"message": {
+								Type:        cty.String,
+								Optional:    true,
+								Description: "Custom message to send instead of Buildkite's default.",
+							},
+						},
+					},
+				},
+				"github_commit_status": {
+					Nesting: tfschema.NestingSingle,
+					Content: tfschema.BlockType{
+						Attributes: map[string]*tfschema.Attribute{
+							"context": {
+								Type:        cty.String,
+								Optional:    true,
+								Description: "Context to use for the GitHub commit status, instead of Buildkite's default.",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// validateNotifyBlocks checks that each of the given notify blocks selects
+// exactly one of the given kinds of notification. The diagnostics it returns
+// have paths relative to the list of notify blocks.
+func validateNotifyBlocks(readers []tfobj.ObjectReader, kinds []string, context string) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	allowed := make(map[string]struct{}, len(kinds))
+	for _, kind := range kinds {
+		allowed[kind] = struct{}{}
+	}
+
+	for i, reader := range readers {
+		path := cty.IndexPath(cty.NumberIntVal(int64(i)))
+
+		var set []string
+		for _, kind := range pipelineNotifyKinds {
+			isSet := false
+			switch kind {
+			case "slack", "github_commit_status":
+				isSet = reader.BlockCount(kind) != 0
+			default:
+				isSet = !reader.Attr(kind).IsNull()
+			}
+			if !isSet {
+				continue
+			}
+			set = append(set, kind)
+
+			if _, ok := allowed[kind]; !ok {
+				diags = diags.Append(tfsdk.Diagnostic{
+					Severity: tfsdk.Error,
+					Summary:  "Unsupported notification",
+					Detail:   fmt.Sprintf("%q notifications cannot be used for %s. The supported kinds are: %s.", kind, context, strings.Join(kinds, ", ")),
+					Path:     path.Copy().GetAttr(kind),
+				})
+			}
+		}
+
+		switch len(set) {
+		case 0:
+			diags = diags.Append(stepArgumentError(path, "one of %s must be set", strings.Join(kinds, ", ")))
+		case 1:
+			// Okay
+		default:
+			diags = diags.Append(stepArgumentError(path, "only one of %s may be set in each notify block", strings.Join(set, ", ")))
+		}
+	}
+
+	return diags
+}
+
+func buildAPINotificationsFromMRT(objs []pipelineMRTNotify) []*apiNotification {
+	ret := make([]*apiNotification, 0, len(objs))
+	for _, obj := range objs {
+		notification := &apiNotification{
+			Email:                obj.Email,
+			BasecampCampfire:     obj.BasecampCampfire,
+			Webhook:              obj.Webhook,
+			PagerdutyChangeEvent: obj.PagerdutyChangeEvent,
+			If:                   obj.If,
+		}
+		if slack := obj.Slack; slack != nil {
+			notification.Slack = &apiSlackNotification{
+				Channels: slack.Channels,
+				Message:  slack.Message,
+			}
+		}
+		if status := obj.GitHubCommitStatus; status != nil {
+			notification.GitHubCommitStatus = &apiGitHubCommitStatusNotification{
+				Context: status.Context,
+			}
+		}
+		ret = append(ret, notification)
+	}
+	return ret
+}
+
+func buildMRTNotifyFromAPI(notifications []*apiNotification) []pipelineMRTNotify {
+	ret := make([]pipelineMRTNotify, 0, len(notifications))
+	for _, notification := range notifications {
+		obj := pipelineMRTNotify{
+			Email:                nonEmptyString(notification.Email),
+			BasecampCampfire:     nonEmptyString(notification.BasecampCampfire),
+			Webhook:              nonEmptyString(notification.Webhook),
+			PagerdutyChangeEvent: nonEmptyString(notification.PagerdutyChangeEvent),
+			If:                   nonEmptyString(notification.If),
+		}
+		if slack := notification.Slack; slack != nil {
+			channels := slack.Channels
+			if channels == nil {
+				channels = []string{}
+			}
+			obj.Slack = &pipelineMRTSlackNotify{
+				Channels: channels,
+				Message:  nonEmptyString(slack.Message),
+			}
+		}
+		if status := notification.GitHubCommitStatus; status != nil {
+			obj.GitHubCommitStatus = &pipelineMRTGitHubCommitStatusNotify{
+				Context: nonEmptyString(status.Context),
+			}
+		}
+		ret = append(ret, obj)
+	}
+	return ret
+}
@@ -0,0 +1,164 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	tfsdk "github.com/apparentlymart/terraform-sdk"
+	"github.com/apparentlymart/terraform-sdk/tfschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type pipelineMRTStepPlugin struct {
+	Source string  `cty:"source"`
+	Config *string `cty:"config"`
+}
+
+// pluginSourcePattern matches the plugin source syntax that the Buildkite
+// agent accepts: a plugin name, a GitHub "org/repo" path, or a full
+// repository URL, optionally followed by "#" and a git ref.
+var pluginSourcePattern = regexp.MustCompile(`^(?:[A-Za-z0-9_.-]+(?:/[A-Za-z0-9_.-]+)?|[a-z][a-z0-9+.-]*://[^\s#]+|[^\s#@:]+@[^\s#:]+:[^\s#]+)(?:#[^\s#]+)?$`)
+
+// pipelineStepPluginSchema returns the schema for the "plugin" nested block
+// type within a step block.
+//
+// Plugin configuration can have an arbitrary structure, so we accept it as a
+// JSON string rather than as nested blocks. Callers will typically use the
+// jsonencode function to produce it.
+//
+// We can't accept a dynamically-typed value instead, because Terraform then
+// sends all of the enclosing "plugin" and "step" blocks as tuples rather than
+// lists, and gocty cannot decode a tuple into the slices in pipelineMRTStep.
+func pipelineStepPluginSchema() *tfschema.NestedBlockType {
+	return &tfschema.NestedBlockType{
+		Nesting: tfschema.NestingList,
+		Content: tfschema.BlockType{
+			Attributes: map[string]*tfschema.Attribute{
+				"source": {
+					Type:        cty.String,
+					Required:    true,
+					Description: "Plugin to use, such as \"docker-compose#v4.0.0\".",
+
+					ValidateFn: func(val string) tfsdk.Diagnostics {
+						var diags tfsdk.Diagnostics
+						if !pluginSourcePattern.MatchString(val) {
+							diags = diags.Append(tfsdk.ValidationError(
+								fmt.Errorf("must be a plugin name, \"org/repo\" path, or repository URL, optionally followed by \"#\" and a version, like \"docker-compose#v4.0.0\""),
+							))
+						}
+						return diags
+					},
+				},
+				"config": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "JSON object containing the plugin's configuration, usually written using the jsonencode function. Plugin configuration must be given as a JSON string rather than as a Terraform object value.",
+
+					ValidateFn: func(val string) tfsdk.Diagnostics {
+						var diags tfsdk.Diagnostics
+						var v interface{}
+						if err := json.Unmarshal([]byte(val), &v); err != nil {
+							diags = diags.Append(tfsdk.ValidationError(
+								fmt.Errorf("must be a JSON object: %s", err),
+							))
+						} else if _, isObj := v.(map[string]interface{}); !isObj {
+							diags = diags.Append(tfsdk.ValidationError(
+								fmt.Errorf("must be a JSON object; omit the argument for a plugin that has no configuration"),
+							))
+						}
+						return diags
+					},
+				},
+			},
+		},
+	}
+}
+
+func buildAPIPluginsFromMRT(objs []pipelineMRTStepPlugin) apiPlugins {
+	var ret apiPlugins
+	for _, obj := range objs {
+		plugin := &apiPlugin{Source: obj.Source}
+		if obj.Config != nil {
+			plugin.Config = json.RawMessage(*obj.Config)
+		}
+		ret = append(ret, plugin)
+	}
+	return ret
+}
+
+func buildMRTPluginsFromAPI(plugins apiPlugins) []pipelineMRTStepPlugin {
+	ret := make([]pipelineMRTStepPlugin, 0, len(plugins))
+	for _, plugin := range plugins {
+		obj := pipelineMRTStepPlugin{Source: plugin.Source}
+		if config := canonicalJSON(plugin.Config); config != nil {
+			obj.Config = config
+		}
+		ret = append(ret, obj)
+	}
+	return ret
+}
+
+// normalizeMRTPluginEmpties is the equivalent of normalizeMRTStepEmpties for
+// a step's plugin blocks, which it updates in-place.
+//
+// The API doesn't preserve the formatting or key order of the configuration
+// JSON, so we keep the configuration's JSON string whenever it is
+// semantically equivalent to what the API returned.
+func normalizeMRTPluginEmpties(got, want []pipelineMRTStepPlugin) {
+	for i := range got {
+		if i >= len(want) {
+			break
+		}
+		gotPlugin, wantPlugin := &got[i], &want[i]
+		if gotPlugin.Source != wantPlugin.Source || wantPlugin.Config == nil {
+			continue
+		}
+		if gotPlugin.Config == nil {
+			if jsonEquivalent(*wantPlugin.Config, "{}") {
+				gotPlugin.Config = wantPlugin.Config
+			}
+			continue
+		}
+		if jsonEquivalent(*gotPlugin.Config, *wantPlugin.Config) {
+			gotPlugin.Config = wantPlugin.Config
+		}
+	}
+}
+
+// canonicalJSON returns the given JSON in a consistent compact form with
+// object keys sorted, or nil if the given JSON is empty, null, or an empty
+// object.
+func canonicalJSON(raw json.RawMessage) *string {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		// Should never happen for JSON that came from the API, but we'll
+		// preserve it verbatim if it does.
+		s := string(raw)
+		return &s
+	}
+	if obj, isObj := v.(map[string]interface{}); v == nil || (isObj && len(obj) == 0) {
+		return nil
+	}
+	buf, _ := json.Marshal(v) // encoding/json sorts map keys
+	s := string(buf)
+	return &s
+}
+
+// jsonEquivalent returns true if the two given strings are both valid JSON
+// and represent the same value.
+func jsonEquivalent(a, b string) bool {
+	var av, bv interface{}
+	if err := json.Unmarshal([]byte(a), &av); err != nil {
+		return false
+	}
+	if err := json.Unmarshal([]byte(b), &bv); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
@@ -0,0 +1,273 @@
+package provider
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	tfsdk "github.com/apparentlymart/terraform-sdk"
+	"github.com/apparentlymart/terraform-sdk/tfobj"
+	"github.com/apparentlymart/terraform-sdk/tfschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type pipelineMRTProviderSettings struct {
+	TriggerMode                             *string `cty:"trigger_mode"`
+	BuildPullRequests                       *bool   `cty:"build_pull_requests"`
+	PullRequestBranchFilter                 *string `cty:"pull_request_branch_filter"`
+	SkipPullRequestBuildsForExistingCommits *bool   `cty:"skip_pull_request_builds_for_existing_commits"`
+	BuildTags                               *bool   `cty:"build_tags"`
+	PublishCommitStatus                     *bool   `cty:"publish_commit_status"`
+	PublishCommitStatusPerStep              *bool   `cty:"publish_commit_status_per_step"`
+	SeparatePullRequestStatuses             *bool   `cty:"separate_pull_request_statuses"`
+	PrefixPullRequestForkBranchNames        *bool   `cty:"prefix_pull_request_fork_branch_names"`
+	FilterCondition                         *string `cty:"filter_condition"`
+}
+
+// pipelineProviderSettingsSupport records which VCS providers each of the
+// arguments in a provider_settings block applies to, using the provider ids
+// that the Buildkite API uses.
+var pipelineProviderSettingsSupport = map[string][]string{
+	"trigger_mode":                                  {"github"},
+	"build_pull_requests":                           {"github", "bitbucket"},
+	"pull_request_branch_filter":                    {"github", "bitbucket"},
+	"skip_pull_request_builds_for_existing_commits": {"github", "bitbucket"},
+	"build_tags":                                    {"github", "bitbucket"},
+	"publish_commit_status":                         {"github", "bitbucket"},
+	"publish_commit_status_per_step":                {"github", "bitbucket"},
+	"separate_pull_request_statuses":                {"github"},
+	"prefix_pull_request_fork_branch_names":         {"github"},
+	"filter_condition":                              {"github", "bitbucket"},
+}
+
+// pipelineProviderHosts maps the hostnames of the hosted VCS services that
+// Buildkite integrates with to the provider ids that the Buildkite API uses
+// for them.
+var pipelineProviderHosts = map[string]string{
+	"github.com":    "github",
+	"gitlab.com":    "gitlab",
+	"bitbucket.org": "bitbucket",
+}
+
+// pipelineProviderSettingsSchema returns the schema for the provider_settings
+// nested block type.
+//
+// All of the arguments are optional and computed, because Buildkite chooses
+// defaults for any that are not set. Only settings that are explicitly set in
+// the configuration are checked for drift.
+func pipelineProviderSettingsSchema() *tfschema.NestedBlockType {
+	optionalBool := func() *tfschema.Attribute {
+		return &tfschema.Attribute{
+			Type:     cty.Bool,
+			Optional: true,
+			Computed: true,
+		}
+	}
+	requireNonEmpty := func(val string) tfsdk.Diagnostics {
+		var diags tfsdk.Diagnostics
+		if val == "" {
+			diags = diags.Append(tfsdk.ValidationError(
+				fmt.Errorf("must not be empty"),
+			))
+		}
+		return diags
+	}
+
+	return &tfschema.NestedBlockType{
+		Nesting: tfschema.NestingSingle,
+		Content: tfschema.BlockType{
+			Attributes: map[string]*tfschema.Attribute{
+				"trigger_mode": {
+					Type:        cty.String,
+					Optional:    true,
+					Computed:    true,
+					Description: "Which GitHub events trigger builds: \"code\", \"deployment\", \"fork\", or \"none\".",
+
+					ValidateFn: func(val string) tfsdk.Diagnostics {
+						var diags tfsdk.Diagnostics
+						switch val {
+						case "code", "deployment", "fork", "none":
+							// Okay
+						default:
+							diags = diags.Append(tfsdk.ValidationError(
+								fmt.Errorf("must be \"code\", \"deployment\", \"fork\", or \"none\""),
+							))
+						}
+						return diags
+					},
+				},
+				"build_pull_requests": optionalBool(),
+				"pull_request_branch_filter": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Branch filter pattern limiting which pull request branches will be built.",
+					ValidateFn:  requireNonEmpty,
+				},
+				"skip_pull_request_builds_for_existing_commits": optionalBool(),
+				"build_tags":                            optionalBool(),
+				"publish_commit_status":                 optionalBool(),
+				"publish_commit_status_per_step":        optionalBool(),
+				"separate_pull_request_statuses":        optionalBool(),
+				"prefix_pull_request_fork_branch_names": optionalBool(),
+				"filter_condition": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Conditional expression that webhook events must match in order to trigger a build.",
+					ValidateFn:  requireNonEmpty,
+				},
+			},
+		},
+	}
+}
+
+// repositoryProviderID returns the Buildkite provider id for the VCS service
+// that hosts the given repository URL, or an empty string if the repository
+// is not hosted on one of the services Buildkite integrates with.
+//
+// Both URL syntax and the scp-like syntax used by git, such as
+// "git@github.com:example/example.git", are accepted.
+func repositoryProviderID(repository string) string {
+	var host string
+	if strings.Contains(repository, "://") {
+		u, err := url.Parse(repository)
+		if err != nil {
+			return ""
+		}
+		host = u.Hostname()
+	} else {
+		// scp-like syntax: [user@]host:path
+		colon := strings.Index(repository, ":")
+		if colon < 0 {
+			return ""
+		}
+		host = repository[:colon]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+	}
+	return pipelineProviderHosts[strings.ToLower(host)]
+}
+
+// validatePipelineProviderSettings checks that all of the arguments set in
+// the provider_settings block, if any, are applicable to the VCS service
+// that hosts the pipeline's repository.
+//
+// The given reader must be for the configuration rather than the plan, since
+// any unset arguments in the block are unknown in the plan.
+func validatePipelineProviderSettings(reader tfobj.ObjectReader) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	if reader.BlockCount("provider_settings") == 0 {
+		return diags
+	}
+	repositoryVal := reader.Attr("repository")
+	if !repositoryVal.IsKnown() || repositoryVal.IsNull() {
+		// Can't validate until we know which provider we're using.
+		return diags
+	}
+	repository := repositoryVal.AsString()
+	providerID := repositoryProviderID(repository)
+	settings := reader.BlockSingle("provider_settings")
+
+	names := make([]string, 0, len(pipelineProviderSettingsSupport))
+	for name := range pipelineProviderSettingsSupport {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if settings.Attr(name).IsNull() {
+			continue
+		}
+		path := cty.GetAttrPath("provider_settings").GetAttr(name)
+
+		if providerID == "" {
+			diags = diags.Append(tfsdk.Diagnostic{
+				Severity: tfsdk.Error,
+				Summary:  "Unsupported provider setting",
+				Detail:   fmt.Sprintf("The %q setting cannot be used because repository %q is not hosted on GitHub, GitLab, or Bitbucket.", name, repository),
+				Path:     path,
+			})
+			continue
+		}
+
+		supported := false
+		for _, id := range pipelineProviderSettingsSupport[name] {
+			if id == providerID {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			diags = diags.Append(tfsdk.Diagnostic{
+				Severity: tfsdk.Error,
+				Summary:  "Unsupported provider setting",
+				Detail:   fmt.Sprintf("The %q setting does not apply to repositories hosted on %s.", name, providerDisplayName(providerID)),
+				Path:     path,
+			})
+		}
+	}
+
+	return diags
+}
+
+func providerDisplayName(id string) string {
+	switch id {
+	case "github":
+		return "GitHub"
+	case "gitlab":
+		return "GitLab"
+	case "bitbucket":
+		return "Bitbucket"
+	default:
+		return id
+	}
+}
+
+func buildAPIProviderSettingsFromMRT(obj *pipelineMRTProviderSettings) *apiProviderSettings {
+	if obj == nil {
+		return nil
+	}
+
+	ret := &apiProviderSettings{
+		TriggerMode:                             obj.TriggerMode,
+		BuildPullRequests:                       obj.BuildPullRequests,
+		SkipPullRequestBuildsForExistingCommits: obj.SkipPullRequestBuildsForExistingCommits,
+		BuildTags:                               obj.BuildTags,
+		PublishCommitStatus:                     obj.PublishCommitStatus,
+		PublishCommitStatusPerStep:              obj.PublishCommitStatusPerStep,
+		SeparatePullRequestStatuses:             obj.SeparatePullRequestStatuses,
+		PrefixPullRequestForkBranchNames:        obj.PrefixPullRequestForkBranchNames,
+	}
+
+	// The filters are enabled only while they are set, so that removing one
+	// from the configuration turns it off in Buildkite.
+	prFilterEnabled := obj.PullRequestBranchFilter != nil
+	ret.PullRequestBranchFilterEnabled = &prFilterEnabled
+	ret.PullRequestBranchFilterConfiguration = obj.PullRequestBranchFilter
+	filterEnabled := obj.FilterCondition != nil
+	ret.FilterEnabled = &filterEnabled
+	ret.FilterCondition = obj.FilterCondition
+	return ret
+}
+
+func buildMRTProviderSettingsFromAPI(settings *apiProviderSettings) *pipelineMRTProviderSettings {
+	ret := &pipelineMRTProviderSettings{
+		TriggerMode:                             settings.TriggerMode,
+		BuildPullRequests:                       settings.BuildPullRequests,
+		SkipPullRequestBuildsForExistingCommits: settings.SkipPullRequestBuildsForExistingCommits,
+		BuildTags:                               settings.BuildTags,
+		PublishCommitStatus:                     settings.PublishCommitStatus,
+		PublishCommitStatusPerStep:              settings.PublishCommitStatusPerStep,
+		SeparatePullRequestStatuses:             settings.SeparatePullRequestStatuses,
+		PrefixPullRequestForkBranchNames:        settings.PrefixPullRequestForkBranchNames,
+	}
+	if settings.PullRequestBranchFilterEnabled != nil && *settings.PullRequestBranchFilterEnabled {
+		ret.PullRequestBranchFilter = nonEmptyString(settings.PullRequestBranchFilterConfiguration)
+	}
+	if settings.FilterEnabled != nil && *settings.FilterEnabled {
+		ret.FilterCondition = nonEmptyString(settings.FilterCondition)
+	}
+	return ret
+}
@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	tfsdk "github.com/apparentlymart/terraform-sdk"
+	"github.com/apparentlymart/terraform-sdk/tfobj"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// apiBaseURL and webBaseURL are the base URLs that Buildkite uses in the
+	// URLs it returns for a pipeline.
+	apiBaseURL = "https://api.buildkite.com/v2/"
+	webBaseURL = "https://buildkite.com/"
+)
+
+// predictPipelineSlug returns the slug that Buildkite will assign to a new
+// pipeline with the given name, or false if we cannot predict it.
+//
+// Buildkite lowercases the name and replaces each run of characters other
+// than letters and digits with a single dash. It transliterates non-ASCII
+// letters in ways we can't reliably reproduce, and we're not sure how it
+// treats underscores, so we don't predict slugs for names that contain
+// either of those.
+func predictPipelineSlug(name string) (string, bool) {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r > 0x7f || r == '_':
+			return "", false
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			if dash && b.Len() != 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// pipelineURLs returns the API URL, web URL and builds URL of the pipeline
+// with the given slug in the given organization.
+func pipelineURLs(orgSlug, slug string) (url, webURL, buildsURL string) {
+	url = apiBaseURL + "organizations/" + orgSlug + "/pipelines/" + slug
+	webURL = webBaseURL + orgSlug + "/" + slug
+	buildsURL = url + "/builds"
+	return url, webURL, buildsURL
+}
+
+// planPipelineURLs sets the planned slug of a new pipeline to the one that
+// Buildkite is expected to assign, and then sets the planned URLs that are
+// derived from the slug.
+//
+// The badge URL contains a token that Buildkite generates, so it remains
+// unknown until the pipeline is created.
+func planPipelineURLs(plan tfobj.PlanBuilder) {
+	slugVal := cty.UnknownVal(cty.String)
+	if nameVal := plan.Attr("name"); nameVal.IsKnown() && !nameVal.IsNull() {
+		if slug, ok := predictPipelineSlug(nameVal.AsString()); ok {
+			slugVal = cty.StringVal(slug)
+		}
+	}
+	plan.SetAttr("slug", slugVal)
+
+	orgVal := plan.Attr("organization")
+	if !slugVal.IsKnown() || !orgVal.IsKnown() || orgVal.IsNull() {
+		return
+	}
+	url, webURL, buildsURL := pipelineURLs(orgVal.AsString(), slugVal.AsString())
+	plan.SetAttr("url", cty.StringVal(url))
+	plan.SetAttr("web_url", cty.StringVal(webURL))
+	plan.SetAttr("builds_url", cty.StringVal(buildsURL))
+}
+
+// checkPlannedPipelineURLs returns an error diagnostic for each of the slug
+// and URLs of a newly-created pipeline that differs from the value predicted
+// for it during planning.
+func checkPlannedPipelineURLs(planned, created *pipelineMRT) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	check := func(attr, name string, want, got *string) {
+		if want == nil || (got != nil && *got == *want) {
+			return
+		}
+		gotStr := "no value"
+		if got != nil {
+			gotStr = fmt.Sprintf("%q", *got)
+		}
+		diags = diags.Append(tfsdk.Diagnostic{
+			Severity: tfsdk.Error,
+			Summary:  "Unexpected pipeline " + name,
+			Detail:   fmt.Sprintf("The plan for this pipeline predicted that Buildkite would assign it the %s %q, but Buildkite returned %s instead. The pipeline was created, but other resources planned using the predicted value may be incorrect. Please report this as a bug in the Buildkite provider.", name, *want, gotStr),
+			Path:     cty.GetAttrPath(attr),
+		})
+	}
+	check("slug", "slug", planned.Slug, created.Slug)
+	check("url", "API URL", planned.URL, created.URL)
+	check("web_url", "web URL", planned.WebURL, created.WebURL)
+	check("builds_url", "builds URL", planned.BuildsURL, created.BuildsURL)
+
+	return diags
+}
@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestPredictPipelineSlug(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"foo", "foo", true},
+		{"Foo Bar", "foo-bar", true},
+		{"foo -- bar!!baz", "foo-bar-baz", true},
+		{"foo.bar/baz", "foo-bar-baz", true},
+		{"  -foo-  ", "foo", true},
+		{"...foo...bar...", "foo-bar", true},
+		{"Release 2.0", "release-2-0", true},
+		{"123", "123", true},
+		{"v1 :rocket:", "v1-rocket", true},
+
+		// Names that contain no letters or digits have no predictable slug.
+		{"", "", false},
+		{"!!!", "", false},
+
+		// We don't predict slugs for names with non-ASCII characters or
+		// underscores.
+		{"café", "", false},
+		{"foo 🚀", "", false},
+		{"foo_bar", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := predictPipelineSlug(test.name)
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("wrong result\ngot:  %q, %t\nwant: %q, %t", got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
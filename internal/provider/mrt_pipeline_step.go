@@ -0,0 +1,1433 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	tfsdk "github.com/apparentlymart/terraform-sdk"
+	"github.com/apparentlymart/terraform-sdk/tfobj"
+	"github.com/apparentlymart/terraform-sdk/tfschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type pipelineMRTStep struct {
+	Type  string  `cty:"type"`
+	Label *string `cty:"label"`
+
+	Key                    *string                     `cty:"key"`
+	DependsOn              []pipelineMRTStepDependency `cty:"depends_on"`
+	AllowDependencyFailure *bool                       `cty:"allow_dependency_failure"`
+	If                     *string                     `cty:"if"`
+
+	// For "script" steps only
+	Command         *string            `cty:"command"`
+	Commands        *[]string          `cty:"commands"`
+	Env             *map[string]string `cty:"env"`
+	AgentQueryRules *[]string          `cty:"agent_query_rules"`
+	Agents          *map[string]string `cty:"agents"`
+
+	ArtifactPaths        *[]string `cty:"artifact_paths"`
+	TimeoutInMinutes     *int      `cty:"timeout_in_minutes"`
+	Parallelism          *int      `cty:"parallelism"`
+	Concurrency          *int      `cty:"concurrency"`
+	ConcurrencyGroup     *string   `cty:"concurrency_group"`
+	Priority             *int      `cty:"priority"`
+	SoftFail             *bool     `cty:"soft_fail"`
+	SoftFailExitStatuses *[]int    `cty:"soft_fail_exit_statuses"`
+	Skip                 *string   `cty:"skip"`
+	CancelOnBuildFailing *bool     `cty:"cancel_on_build_failing"`
+
+	Retry   *pipelineMRTStepRetry   `cty:"retry"`
+	Plugins []pipelineMRTStepPlugin `cty:"plugin"`
+	Matrix  *pipelineMRTStepMatrix  `cty:"matrix"`
+
+	// For "script" and "group" steps only
+	Notify []pipelineMRTNotify `cty:"notify"`
+
+	// For "script", "trigger" and "manual" steps only
+	BranchConfiguration *string `cty:"branch_configuration"`
+
+	// For "waiter" steps only
+	ContinueOnFailure *bool `cty:"continue_on_failure"`
+
+	// For "trigger" steps only
+	TriggerPipeline *string                  `cty:"trigger_pipeline"`
+	Async           *bool                    `cty:"async"`
+	Build           *pipelineMRTTriggerBuild `cty:"build"`
+
+	// For "manual" steps only
+	Prompt       *string                `cty:"prompt"`
+	BlockedState *string                `cty:"blocked_state"`
+	Fields       []pipelineMRTStepField `cty:"field"`
+
+	// For "group" steps only. This is always nil for the steps nested
+	// inside a group, because groups cannot be nested.
+	Steps []pipelineMRTStep `cty:"step"`
+
+	// TODO: All of the other supported attributes
+}
+
+type pipelineMRTStepDependency struct {
+	Step         string `cty:"step"`
+	AllowFailure *bool  `cty:"allow_failure"`
+}
+
+type pipelineMRTTriggerBuild struct {
+	Message  *string            `cty:"message"`
+	Commit   *string            `cty:"commit"`
+	Branch   *string            `cty:"branch"`
+	Env      *map[string]string `cty:"env"`
+	MetaData *map[string]string `cty:"meta_data"`
+}
+
+type pipelineMRTStepRetry struct {
+	Automatic []pipelineMRTAutomaticRetry `cty:"automatic"`
+	Manual    *pipelineMRTManualRetry     `cty:"manual"`
+}
+
+type pipelineMRTAutomaticRetry struct {
+	ExitStatus   *string `cty:"exit_status"`
+	Limit        *int    `cty:"limit"`
+	SignalReason *string `cty:"signal_reason"`
+}
+
+type pipelineMRTManualRetry struct {
+	Allowed        *bool   `cty:"allowed"`
+	PermitOnPassed *bool   `cty:"permit_on_passed"`
+	Reason         *string `cty:"reason"`
+}
+
+// maxAutomaticRetryLimit is the largest number of automatic retries that
+// Buildkite permits for a single rule.
+const maxAutomaticRetryLimit = 10
+
+type pipelineMRTStepField struct {
+	Text     *string                      `cty:"text"`
+	Select   *string                      `cty:"select"`
+	Key      string                       `cty:"key"`
+	Hint     *string                      `cty:"hint"`
+	Required *bool                        `cty:"required"`
+	Default  *string                      `cty:"default"`
+	Format   *string                      `cty:"format"`
+	Multiple *bool                        `cty:"multiple"`
+	Options  []pipelineMRTStepFieldOption `cty:"option"`
+}
+
+type pipelineMRTStepFieldOption struct {
+	Label string `cty:"label"`
+	Value string `cty:"value"`
+}
+
+// pipelineStepSchema returns the schema for the "step" nested block type
+// within buildkite_pipeline.
+func pipelineStepSchema() *tfschema.NestedBlockType {
+	ret := pipelineChildStepSchema()
+	ret.Content.NestedBlockTypes["step"] = pipelineChildStepSchema()
+	return ret
+}
+
+// pipelineChildStepSchema returns the schema for the "step" nested block type
+// within a "group" step, which is the same as for the top-level steps except
+// that it cannot itself contain nested steps.
+func pipelineChildStepSchema() *tfschema.NestedBlockType {
+	return &tfschema.NestedBlockType{
+		Nesting: tfschema.NestingList,
+		Content: tfschema.BlockType{
+			Attributes: map[string]*tfschema.Attribute{
+				"type": {
+					Type:        cty.String,
+					Optional:    true,
+					Computed:    true,
+					Description: "The type of step: \"command\" (or \"script\"), \"wait\" (or \"waiter\"), \"block\" (or \"manual\"), \"trigger\", or \"group\". Inferred from the step's other arguments if not set, in which case the first of each pair of names is used.",
+				},
+				"label": {
+					Type:     cty.String,
+					Optional: true,
+				},
+
+				"key": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Unique identifier for the step, for use in depends_on.",
+
+					ValidateFn: func(val string) tfsdk.Diagnostics {
+						var diags tfsdk.Diagnostics
+						if strings.TrimSpace(val) == "" {
+							diags = diags.Append(tfsdk.ValidationError(
+								fmt.Errorf("must not be empty"),
+							))
+						}
+						return diags
+					},
+				},
+				"allow_dependency_failure": {
+					Type:        cty.Bool,
+					Optional:    true,
+					Description: "If true, the step runs even if the steps it depends on have failed.",
+				},
+				"if": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Conditional expression that determines whether the step runs.",
+				},
+
+				// For "script" steps only
+				"command": {
+					Type:     cty.String,
+					Optional: true,
+				},
+				"commands": {
+					Type:        cty.List(cty.String),
+					Optional:    true,
+					Description: "Shell commands to run in sequence, as an alternative to a single \"command\".",
+				},
+				"env": {
+					Type:     cty.Map(cty.String),
+					Optional: true,
+				},
+				"agent_query_rules": {
+					Type:     cty.Set(cty.String),
+					Optional: true,
+				},
+				"agents": {
+					Type:        cty.Map(cty.String),
+					Optional:    true,
+					Description: "Agent tags that an agent must have to run the step's jobs, as an alternative to \"agent_query_rules\".",
+				},
+				"artifact_paths": {
+					Type:        cty.List(cty.String),
+					Optional:    true,
+					Description: "Glob patterns for files to upload as artifacts when the step finishes.",
+				},
+				"timeout_in_minutes": {
+					Type:       cty.Number,
+					Optional:   true,
+					ValidateFn: validateTimeoutInMinutes,
+				},
+				"parallelism": {
+					Type:        cty.Number,
+					Optional:    true,
+					Description: "Number of parallel jobs to create for the step.",
+					ValidateFn:  validateStepJobCount,
+				},
+				"concurrency": {
+					Type:        cty.Number,
+					Optional:    true,
+					Description: "Maximum number of jobs in concurrency_group that may run at once.",
+					ValidateFn:  validateStepJobCount,
+				},
+				"concurrency_group": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Name of a group of jobs, across all builds, that the concurrency limit applies to.",
+				},
+				"priority": {
+					Type:        cty.Number,
+					Optional:    true,
+					Description: "Priority of the step's jobs relative to others waiting for the same agents. Higher numbers run first.",
+				},
+				"soft_fail": {
+					Type:        cty.Bool,
+					Optional:    true,
+					Description: "If true, a failure of this step does not fail the build.",
+				},
+				"soft_fail_exit_statuses": {
+					Type:        cty.Set(cty.Number),
+					Optional:    true,
+					Description: "Exit statuses that do not fail the build. Cannot be used together with soft_fail.",
+				},
+				"skip": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Either true to skip the step, or a reason for skipping it to show in the Buildkite UI.",
+				},
+				"cancel_on_build_failing": {
+					Type:        cty.Bool,
+					Optional:    true,
+					Description: "If true, running jobs from this step are cancelled as soon as the build is marked as failing.",
+				},
+
+				// For "script", "trigger" and "manual" steps only
+				"branch_configuration": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Branch filter pattern limiting which branches the step runs on.",
+				},
+
+				// For "waiter" steps only
+				"continue_on_failure": {
+					Type:        cty.Bool,
+					Optional:    true,
+					Description: "If true, the steps after this one run even if the steps before it failed.",
+				},
+
+				// For "trigger" steps only
+				"trigger_pipeline": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Slug of the pipeline to create a build in.",
+				},
+				"async": {
+					Type:        cty.Bool,
+					Optional:    true,
+					Description: "If true, the step passes as soon as the triggered build is created, rather than waiting for it to complete.",
+				},
+
+				// For "manual" steps only
+				"prompt": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Instructional message displayed in the dialog box when the step is unblocked.",
+				},
+				"blocked_state": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "State of the build while it is blocked on this step: \"passed\", \"failed\", or \"running\".",
+
+					ValidateFn: func(val string) tfsdk.Diagnostics {
+						var diags tfsdk.Diagnostics
+						switch val {
+						case "passed", "failed", "running":
+							// Okay
+						default:
+							diags = diags.Append(tfsdk.ValidationError(
+								fmt.Errorf("must be \"passed\", \"failed\", or \"running\""),
+							))
+						}
+						return diags
+					},
+				},
+			},
+			NestedBlockTypes: map[string]*tfschema.NestedBlockType{
+				"depends_on": {
+					Nesting: tfschema.NestingList,
+					Content: tfschema.BlockType{
+						Attributes: map[string]*tfschema.Attribute{
+							"step": {
+								Type:        cty.String,
+								Required:    true,
+								Description: "Key of the step that must complete before this one runs.",
+							},
+							"allow_failure": {
+								Type:        cty.Bool,
+								Optional:    true,
+								Description: "If true, this step runs even if the other step fails.",
+							},
+						},
+					},
+				},
+
+				// For "script" steps only
+				"plugin": pipelineStepPluginSchema(),
+				"matrix": pipelineStepMatrixSchema(),
+				"retry": {
+					Nesting: tfschema.NestingSingle,
+					Content: tfschema.BlockType{
+						NestedBlockTypes: map[string]*tfschema.NestedBlockType{
+							"automatic": {
+								Nesting: tfschema.NestingList,
+								Content: tfschema.BlockType{
+									Attributes: map[string]*tfschema.Attribute{
+										"exit_status": {
+											Type:        cty.String,
+											Optional:    true,
+											Description: "Exit status that the rule applies to, or \"*\" for any non-zero exit status.",
+
+											ValidateFn: func(val string) tfsdk.Diagnostics {
+												var diags tfsdk.Diagnostics
+												if _, err := strconv.Atoi(val); err != nil && val != "*" {
+													diags = diags.Append(tfsdk.ValidationError(
+														fmt.Errorf("must be either an integer or \"*\""),
+													))
+												}
+												return diags
+											},
+										},
+										"limit": {
+											Type:        cty.Number,
+											Optional:    true,
+											Description: "Number of times to retry. Buildkite allows at most 10.",
+
+											ValidateFn: func(val int) tfsdk.Diagnostics {
+												var diags tfsdk.Diagnostics
+												if val < 1 || val > maxAutomaticRetryLimit {
+													diags = diags.Append(tfsdk.ValidationError(
+														fmt.Errorf("must be between 1 and %d", maxAutomaticRetryLimit),
+													))
+												}
+												return diags
+											},
+										},
+										"signal_reason": {
+											Type:        cty.String,
+											Optional:    true,
+											Description: "Reason the job was stopped by a signal, such as \"agent_stop\" or \"cancel\", or \"*\" for any reason.",
+										},
+									},
+								},
+							},
+							"manual": {
+								Nesting: tfschema.NestingSingle,
+								Content: tfschema.BlockType{
+									Attributes: map[string]*tfschema.Attribute{
+										"allowed": {
+											Type:        cty.Bool,
+											Optional:    true,
+											Description: "Whether jobs can be retried manually. Buildkite's default is true.",
+										},
+										"permit_on_passed": {
+											Type:        cty.Bool,
+											Optional:    true,
+											Description: "Whether jobs can be retried manually after they have passed.",
+										},
+										"reason": {
+											Type:        cty.String,
+											Optional:    true,
+											Description: "Message shown in the Buildkite UI when manual retry is not allowed.",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+
+				// For "script" and "group" steps only
+				"notify": pipelineNotifySchema(),
+
+				// For "manual" steps only
+				"field": {
+					Nesting: tfschema.NestingList,
+					Content: tfschema.BlockType{
+						Attributes: map[string]*tfschema.Attribute{
+							"text": {
+								Type:        cty.String,
+								Optional:    true,
+								Description: "Label for a text input field. Exactly one of text or select must be set.",
+							},
+							"select": {
+								Type:        cty.String,
+								Optional:    true,
+								Description: "Label for a select input field. Exactly one of text or select must be set.",
+							},
+							"key": {
+								Type:     cty.String,
+								Required: true,
+							},
+							"hint": {
+								Type:     cty.String,
+								Optional: true,
+							},
+							"required": {
+								Type:        cty.Bool,
+								Optional:    true,
+								Description: "Whether a value must be given for the field. Buildkite's default is true.",
+							},
+							"default": {
+								Type:     cty.String,
+								Optional: true,
+							},
+							"format": {
+								Type:        cty.String,
+								Optional:    true,
+								Description: "Regular expression that the value of a text field must match.",
+							},
+							"multiple": {
+								Type:        cty.Bool,
+								Optional:    true,
+								Description: "Whether more than one option can be chosen in a select field.",
+							},
+						},
+						NestedBlockTypes: map[string]*tfschema.NestedBlockType{
+							"option": {
+								Nesting: tfschema.NestingList,
+								Content: tfschema.BlockType{
+									Attributes: map[string]*tfschema.Attribute{
+										"label": {
+											Type:     cty.String,
+											Required: true,
+										},
+										"value": {
+											Type:     cty.String,
+											Required: true,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+
+				// For "trigger" steps only
+				"build": {
+					Nesting: tfschema.NestingSingle,
+					Content: tfschema.BlockType{
+						Attributes: map[string]*tfschema.Attribute{
+							"message": {
+								Type:     cty.String,
+								Optional: true,
+							},
+							"commit": {
+								Type:     cty.String,
+								Optional: true,
+							},
+							"branch": {
+								Type:     cty.String,
+								Optional: true,
+							},
+							"env": {
+								Type:     cty.Map(cty.String),
+								Optional: true,
+							},
+							"meta_data": {
+								Type:     cty.Map(cty.String),
+								Optional: true,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func buildAPIStepsFromMRT(objs []pipelineMRTStep) []*apiStep {
+	ret := make([]*apiStep, 0, len(objs))
+	for i := range objs {
+		ret = append(ret, buildAPIStepFromMRT(&objs[i]))
+	}
+	return ret
+}
+
+func buildAPIStepFromMRT(obj *pipelineMRTStep) *apiStep {
+	stepType := apiStepType(obj.Type)
+	ret := &apiStep{
+		Type:    &stepType,
+		Name:    obj.Label,
+		Command: obj.Command,
+
+		Key:                    obj.Key,
+		AllowDependencyFailure: obj.AllowDependencyFailure,
+		If:                     obj.If,
+
+		ContinueOnFailure: obj.ContinueOnFailure,
+
+		TriggerProjectSlug: obj.TriggerPipeline,
+		TriggerAsync:       obj.Async,
+
+		Prompt:       obj.Prompt,
+		BlockedState: obj.BlockedState,
+	}
+
+	for _, fieldObj := range obj.Fields {
+		field := &apiStepField{
+			Text:     fieldObj.Text,
+			Select:   fieldObj.Select,
+			Key:      fieldObj.Key,
+			Hint:     fieldObj.Hint,
+			Required: fieldObj.Required,
+			Default:  fieldObj.Default,
+			Format:   fieldObj.Format,
+			Multiple: fieldObj.Multiple,
+		}
+		for _, optionObj := range fieldObj.Options {
+			field.Options = append(field.Options, &apiStepFieldOption{
+				Label: optionObj.Label,
+				Value: optionObj.Value,
+			})
+		}
+		ret.Fields = append(ret.Fields, field)
+	}
+
+	if obj.Env != nil {
+		ret.Env = *obj.Env
+	}
+	if obj.Commands != nil {
+		// The API expects multiple commands as a single string, separated
+		// by newlines.
+		command := strings.Join(*obj.Commands, "\n")
+		ret.Command = &command
+	}
+	if obj.AgentQueryRules != nil {
+		ret.AgentQueryRules = *obj.AgentQueryRules
+	}
+	if obj.Agents != nil {
+		ret.AgentQueryRules = agentQueryRulesFromMap(*obj.Agents)
+	}
+
+	if obj.ArtifactPaths != nil && len(*obj.ArtifactPaths) != 0 {
+		// The API expects multiple artifact paths as a single string,
+		// separated by semicolons.
+		paths := strings.Join(*obj.ArtifactPaths, ";")
+		ret.ArtifactPaths = &paths
+	}
+	ret.BranchConfiguration = obj.BranchConfiguration
+	ret.TimeoutInMinutes = obj.TimeoutInMinutes
+	ret.Parallelism = obj.Parallelism
+	ret.Concurrency = obj.Concurrency
+	ret.ConcurrencyGroup = obj.ConcurrencyGroup
+	ret.Priority = obj.Priority
+	ret.CancelOnBuildFailing = obj.CancelOnBuildFailing
+	switch {
+	case obj.SoftFailExitStatuses != nil && len(*obj.SoftFailExitStatuses) != 0:
+		ret.SoftFail = &apiSoftFail{ExitStatuses: *obj.SoftFailExitStatuses}
+	case obj.SoftFail != nil:
+		ret.SoftFail = &apiSoftFail{All: *obj.SoftFail}
+	}
+	for _, depObj := range obj.DependsOn {
+		ret.DependsOn = append(ret.DependsOn, &apiDependency{
+			Step:         depObj.Step,
+			AllowFailure: depObj.AllowFailure,
+		})
+	}
+	if obj.Type == "group" {
+		ret.Group, ret.Name = obj.Label, nil
+		ret.Steps = buildAPIStepsFromMRT(obj.Steps)
+	}
+	if len(obj.Notify) != 0 {
+		ret.Notify = buildAPINotificationsFromMRT(obj.Notify)
+	}
+	ret.Plugins = buildAPIPluginsFromMRT(obj.Plugins)
+	if retry := obj.Retry; retry != nil {
+		ret.Retry = &apiRetry{}
+		for _, ruleObj := range retry.Automatic {
+			rule := &apiAutomaticRetry{
+				Limit:        ruleObj.Limit,
+				SignalReason: ruleObj.SignalReason,
+			}
+			if ruleObj.ExitStatus != nil {
+				status := apiExitStatus(*ruleObj.ExitStatus)
+				rule.ExitStatus = &status
+			}
+			ret.Retry.Automatic = append(ret.Retry.Automatic, rule)
+		}
+		if manual := retry.Manual; manual != nil {
+			ret.Retry.Manual = &apiManualRetry{
+				Allowed:        manual.Allowed,
+				PermitOnPassed: manual.PermitOnPassed,
+				Reason:         manual.Reason,
+			}
+		}
+	}
+	ret.Skip = buildAPISkipFromMRT(obj.Skip)
+	ret.Matrix = buildAPIMatrixFromMRT(obj.Matrix)
+
+	if build := obj.Build; build != nil {
+		ret.TriggerMessage = build.Message
+		ret.TriggerCommit = build.Commit
+		ret.TriggerBranch = build.Branch
+		if build.Env != nil {
+			ret.TriggerEnv = *build.Env
+		}
+		if build.MetaData != nil {
+			ret.TriggerMetaData = *build.MetaData
+		}
+	}
+
+	return ret
+}
+
+func buildMRTStepFromAPI(step *apiStep) pipelineMRTStep {
+	ret := pipelineMRTStep{
+		Type:    yamlStepType(*step.Type),
+		Label:   step.Name,
+		Command: step.Command,
+
+		Key:                    nonEmptyString(step.Key),
+		DependsOn:              make([]pipelineMRTStepDependency, 0, len(step.DependsOn)),
+		AllowDependencyFailure: trueOrNil(step.AllowDependencyFailure),
+		If:                     nonEmptyString(step.If),
+
+		ContinueOnFailure: trueOrNil(step.ContinueOnFailure),
+
+		TriggerPipeline: step.TriggerProjectSlug,
+		Async:           trueOrNil(step.TriggerAsync),
+
+		Prompt:       nonEmptyString(step.Prompt),
+		BlockedState: step.BlockedState,
+		Fields:       make([]pipelineMRTStepField, 0, len(step.Fields)),
+	}
+
+	for _, field := range step.Fields {
+		fieldObj := pipelineMRTStepField{
+			Text:     field.Text,
+			Select:   field.Select,
+			Key:      field.Key,
+			Hint:     nonEmptyString(field.Hint),
+			Required: field.Required,
+			Default:  nonEmptyString(field.Default),
+			Format:   nonEmptyString(field.Format),
+			Multiple: trueOrNil(field.Multiple),
+			Options:  make([]pipelineMRTStepFieldOption, 0, len(field.Options)),
+		}
+		for _, option := range field.Options {
+			fieldObj.Options = append(fieldObj.Options, pipelineMRTStepFieldOption{
+				Label: option.Label,
+				Value: option.Value,
+			})
+		}
+		ret.Fields = append(ret.Fields, fieldObj)
+	}
+
+	// The API omits empty collections, so we represent those as null here
+	// and then use normalizeMRTStepEmpties to reconcile with the
+	// configuration where needed.
+	ret.Env = nonEmptyMap(step.Env)
+	if len(step.AgentQueryRules) != 0 {
+		rules := step.AgentQueryRules
+		ret.AgentQueryRules = &rules
+	}
+
+	if step.ArtifactPaths != nil && *step.ArtifactPaths != "" {
+		var paths []string
+		for _, path := range strings.Split(*step.ArtifactPaths, ";") {
+			if path = strings.TrimSpace(path); path != "" {
+				paths = append(paths, path)
+			}
+		}
+		ret.ArtifactPaths = &paths
+	}
+	ret.BranchConfiguration = nonEmptyString(step.BranchConfiguration)
+	ret.TimeoutInMinutes = nonZeroInt(step.TimeoutInMinutes)
+	ret.Parallelism = nonZeroInt(step.Parallelism)
+	ret.Concurrency = nonZeroInt(step.Concurrency)
+	ret.ConcurrencyGroup = nonEmptyString(step.ConcurrencyGroup)
+	ret.Priority = nonZeroInt(step.Priority)
+	ret.CancelOnBuildFailing = trueOrNil(step.CancelOnBuildFailing)
+	if sf := step.SoftFail; sf != nil {
+		if len(sf.ExitStatuses) != 0 {
+			statuses := sf.ExitStatuses
+			ret.SoftFailExitStatuses = &statuses
+		} else if sf.All {
+			ret.SoftFail = &sf.All
+		}
+	}
+	for _, dep := range step.DependsOn {
+		ret.DependsOn = append(ret.DependsOn, pipelineMRTStepDependency{
+			Step:         dep.Step,
+			AllowFailure: trueOrNil(dep.AllowFailure),
+		})
+	}
+	ret.Steps = make([]pipelineMRTStep, 0, len(step.Steps))
+	if ret.Type == "group" {
+		if step.Group != nil {
+			ret.Label = step.Group
+		}
+		for _, child := range step.Steps {
+			ret.Steps = append(ret.Steps, buildMRTStepFromAPI(child))
+		}
+	}
+	ret.Notify = buildMRTNotifyFromAPI(step.Notify)
+	ret.Plugins = buildMRTPluginsFromAPI(step.Plugins)
+	if retry := step.Retry; retry != nil {
+		retryObj := &pipelineMRTStepRetry{
+			Automatic: make([]pipelineMRTAutomaticRetry, 0, len(retry.Automatic)),
+		}
+		for _, rule := range retry.Automatic {
+			ruleObj := pipelineMRTAutomaticRetry{
+				Limit:        nonZeroInt(rule.Limit),
+				SignalReason: nonEmptyString(rule.SignalReason),
+			}
+			if rule.ExitStatus != nil && *rule.ExitStatus != "" {
+				status := string(*rule.ExitStatus)
+				ruleObj.ExitStatus = &status
+			}
+			retryObj.Automatic = append(retryObj.Automatic, ruleObj)
+		}
+		if manual := retry.Manual; manual != nil {
+			retryObj.Manual = &pipelineMRTManualRetry{
+				Allowed:        manual.Allowed,
+				PermitOnPassed: trueOrNil(manual.PermitOnPassed),
+				Reason:         nonEmptyString(manual.Reason),
+			}
+		}
+		ret.Retry = retryObj
+	}
+	ret.Skip = buildMRTSkipFromAPI(step.Skip)
+	ret.Matrix = buildMRTMatrixFromAPI(step.Matrix)
+
+	build := &pipelineMRTTriggerBuild{
+		Message:  nonEmptyString(step.TriggerMessage),
+		Commit:   nonEmptyString(step.TriggerCommit),
+		Branch:   nonEmptyString(step.TriggerBranch),
+		Env:      nonEmptyMap(step.TriggerEnv),
+		MetaData: nonEmptyMap(step.TriggerMetaData),
+	}
+	if !build.isEmpty() {
+		ret.Build = build
+	}
+
+	return ret
+}
+
+// normalizeMRTStepEmpties is the equivalent of normalizeMRTPipelineEmpties
+// for a single step.
+func normalizeMRTStepEmpties(got, want *pipelineMRTStep) {
+	for i := range got.Steps {
+		if i >= len(want.Steps) {
+			break
+		}
+		normalizeMRTStepEmpties(&got.Steps[i], &want.Steps[i])
+	}
+	if apiStepType(want.Type) == apiStepType(got.Type) {
+		got.Type = want.Type
+	}
+	normalizeEmptyString(&got.If, want.If)
+	normalizeFalse(&got.AllowDependencyFailure, want.AllowDependencyFailure)
+	for i := range got.DependsOn {
+		if i >= len(want.DependsOn) {
+			break
+		}
+		normalizeFalse(&got.DependsOn[i].AllowFailure, want.DependsOn[i].AllowFailure)
+	}
+	normalizeEmptyMap(&got.Env, want.Env)
+
+	// The API has only the singular forms of the command and agent
+	// arguments, so we must convert to the plural forms if that's what the
+	// configuration uses.
+	if want.Commands != nil && got.Command != nil {
+		if *got.Command == strings.Join(*want.Commands, "\n") {
+			got.Commands = want.Commands
+		} else {
+			commands := strings.Split(*got.Command, "\n")
+			got.Commands = &commands
+		}
+		got.Command = nil
+	}
+	if want.Agents != nil && got.AgentQueryRules != nil {
+		if agents, ok := agentsFromQueryRules(*got.AgentQueryRules); ok {
+			got.Agents = &agents
+			got.AgentQueryRules = nil
+		}
+	}
+	normalizeEmptyMap(&got.Agents, want.Agents)
+	if got.AgentQueryRules == nil && want.AgentQueryRules != nil && len(*want.AgentQueryRules) == 0 {
+		got.AgentQueryRules = want.AgentQueryRules
+	}
+	if got.ArtifactPaths == nil && want.ArtifactPaths != nil && len(*want.ArtifactPaths) == 0 {
+		got.ArtifactPaths = want.ArtifactPaths
+	}
+	normalizeEmptyString(&got.BranchConfiguration, want.BranchConfiguration)
+	normalizeEmptyString(&got.ConcurrencyGroup, want.ConcurrencyGroup)
+	normalizeZeroInt(&got.Priority, want.Priority)
+	normalizeFalse(&got.CancelOnBuildFailing, want.CancelOnBuildFailing)
+	normalizeFalse(&got.SoftFail, want.SoftFail)
+	if got.SoftFailExitStatuses == nil && want.SoftFailExitStatuses != nil && len(*want.SoftFailExitStatuses) == 0 {
+		got.SoftFailExitStatuses = want.SoftFailExitStatuses
+	}
+	normalizeSkip(&got.Skip, want.Skip)
+	got.Retry = normalizeMRTStepRetryEmpties(got.Retry, want.Retry)
+	normalizeMRTPluginEmpties(got.Plugins, want.Plugins)
+	normalizeMRTMatrixEmpties(got.Matrix, want.Matrix)
+	normalizeFalse(&got.ContinueOnFailure, want.ContinueOnFailure)
+	normalizeFalse(&got.Async, want.Async)
+	normalizeEmptyString(&got.Prompt, want.Prompt)
+
+	for i := range got.Fields {
+		if i >= len(want.Fields) {
+			break
+		}
+		gotField, wantField := &got.Fields[i], &want.Fields[i]
+		normalizeEmptyString(&gotField.Hint, wantField.Hint)
+		normalizeEmptyString(&gotField.Default, wantField.Default)
+		normalizeEmptyString(&gotField.Format, wantField.Format)
+		normalizeFalse(&gotField.Multiple, wantField.Multiple)
+
+		// Fields are required by default, so we don't record an explicit
+		// true unless the configuration did.
+		if wantField.Required == nil && gotField.Required != nil && *gotField.Required {
+			gotField.Required = nil
+		}
+	}
+
+	if want.Build != nil {
+		if got.Build == nil && want.Build.isEmpty() {
+			got.Build = &pipelineMRTTriggerBuild{}
+		}
+		if got.Build != nil {
+			normalizeEmptyString(&got.Build.Message, want.Build.Message)
+			normalizeEmptyString(&got.Build.Commit, want.Build.Commit)
+			normalizeEmptyString(&got.Build.Branch, want.Build.Branch)
+			normalizeEmptyMap(&got.Build.Env, want.Build.Env)
+			normalizeEmptyMap(&got.Build.MetaData, want.Build.MetaData)
+		}
+	}
+}
+
+// normalizeMRTStepRetryEmpties is the equivalent of normalizeMRTStepEmpties
+// for a step's retry block, returning the normalized block.
+func normalizeMRTStepRetryEmpties(got, want *pipelineMRTStepRetry) *pipelineMRTStepRetry {
+	if got == nil {
+		if want != nil && len(want.Automatic) == 0 && want.Manual == nil {
+			return want
+		}
+		return nil
+	}
+
+	var wantManual *pipelineMRTManualRetry
+	if want != nil {
+		wantManual = want.Manual
+		for i := range got.Automatic {
+			if i >= len(want.Automatic) {
+				break
+			}
+			gotRule, wantRule := &got.Automatic[i], &want.Automatic[i]
+			normalizeZeroInt(&gotRule.Limit, wantRule.Limit)
+			normalizeEmptyString(&gotRule.SignalReason, wantRule.SignalReason)
+		}
+	}
+
+	if manual := got.Manual; manual != nil {
+		if wantManual == nil {
+			// Buildkite may echo back its default manual retry settings
+			// even if we didn't send any, so we'll ignore them if they
+			// match the defaults.
+			if (manual.Allowed == nil || *manual.Allowed) && manual.PermitOnPassed == nil && manual.Reason == nil {
+				got.Manual = nil
+			}
+		} else {
+			// Manual retry is allowed by default, so we don't record an
+			// explicit true unless the configuration did.
+			if wantManual.Allowed == nil && manual.Allowed != nil && *manual.Allowed {
+				manual.Allowed = nil
+			}
+			normalizeFalse(&manual.PermitOnPassed, wantManual.PermitOnPassed)
+			normalizeEmptyString(&manual.Reason, wantManual.Reason)
+		}
+	} else if wantManual != nil && *wantManual == (pipelineMRTManualRetry{}) {
+		got.Manual = wantManual
+	}
+
+	if want == nil && len(got.Automatic) == 0 && got.Manual == nil {
+		return nil
+	}
+	return got
+}
+
+// isEmpty returns true if none of the arguments in the receiving build block
+// have non-empty values.
+func (b *pipelineMRTTriggerBuild) isEmpty() bool {
+	return nonEmptyString(b.Message) == nil &&
+		nonEmptyString(b.Commit) == nil &&
+		nonEmptyString(b.Branch) == nil &&
+		(b.Env == nil || len(*b.Env) == 0) &&
+		(b.MetaData == nil || len(*b.MetaData) == 0)
+}
+
+func normalizeEmptyMap(got **map[string]string, want *map[string]string) {
+	if *got == nil && want != nil && len(*want) == 0 {
+		*got = want
+	}
+}
+
+func nonEmptyMap(m map[string]string) *map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	return &m
+}
+
+func validateStepBlocks(readers []tfobj.ObjectReader) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	if len(readers) == 0 {
+		diags = diags.Append(tfsdk.Diagnostic{
+			Severity: tfsdk.Error,
+			Summary:  "No Buildkite pipeline steps",
+			Detail:   "A Buildkite pipeline must have at least one \"step\" block.",
+		})
+	}
+
+	for i, reader := range readers {
+		path := cty.IndexPath(cty.NumberIntVal(int64(i)))
+		moreDiags := validateStepBlock(reader)
+		diags = diags.Append(moreDiags.UnderPath(path))
+
+		stepTypeVal := reader.Attr("type")
+		if !stepTypeVal.IsKnown() {
+			continue
+		}
+		if stepTypeVal.AsString() != "group" {
+			if reader.BlockCount("step") != 0 {
+				diags = diags.Append(tfsdk.Diagnostic{
+					Severity: tfsdk.Error,
+					Summary:  "Unsupported nested steps",
+					Detail:   "Nested \"step\" blocks are allowed only in \"group\" steps.",
+					Path:     path.Copy().GetAttr("step"),
+				})
+			}
+			continue
+		}
+		for j, childReader := range reader.BlockList("step") {
+			childPath := path.Copy().GetAttr("step").Index(cty.NumberIntVal(int64(j)))
+			if childTypeVal := childReader.Attr("type"); childTypeVal.IsKnown() && childTypeVal.AsString() == "group" {
+				diags = diags.Append(tfsdk.Diagnostic{
+					Severity: tfsdk.Error,
+					Summary:  "Nested group step",
+					Detail:   "A \"group\" step cannot contain another \"group\" step.",
+					Path:     childPath.GetAttr("type"),
+				})
+				continue
+			}
+			moreDiags := validateStepBlock(childReader)
+			diags = diags.Append(moreDiags.UnderPath(childPath))
+		}
+	}
+
+	diags = diags.Append(validateStepGraph(readers))
+
+	return diags
+}
+
+func validateStepBlock(reader tfobj.ObjectReader) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	stepTypeVal := reader.Attr("type")
+	if !stepTypeVal.IsKnown() {
+		// Can't validate at all yet, then
+		return diags
+	}
+	stepType := stepTypeVal.AsString()
+	switch apiStepType(stepType) {
+
+	case "script":
+		if reader.Attr("command").IsNull() && reader.Attr("commands").IsNull() && reader.BlockCount("plugin") == 0 {
+			diags = diags.Append(tfsdk.ValidationError(fmt.Errorf("either a \"command\" or \"commands\" argument or at least one \"plugin\" block is required for %q steps", stepType)))
+		}
+		diags = diags.Append(rejectStepArguments(reader, stepType, triggerStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, manualStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, waiterStepArguments...))
+
+		commandsVal := reader.Attr("commands")
+		if !reader.Attr("command").IsNull() && !commandsVal.IsNull() {
+			diags = diags.Append(tfsdk.ValidationError(
+				cty.GetAttrPath("commands").NewErrorf("only one of \"command\" or \"commands\" may be set"),
+			))
+		}
+		if commandsVal.IsKnown() && !commandsVal.IsNull() && commandsVal.LengthInt() == 0 {
+			diags = diags.Append(tfsdk.ValidationError(
+				cty.GetAttrPath("commands").NewErrorf("at least one command is required"),
+			))
+		}
+		if !reader.Attr("agent_query_rules").IsNull() && !reader.Attr("agents").IsNull() {
+			diags = diags.Append(tfsdk.ValidationError(
+				cty.GetAttrPath("agents").NewErrorf("only one of \"agent_query_rules\" or \"agents\" may be set"),
+			))
+		}
+
+		concurrencySet := !reader.Attr("concurrency").IsNull()
+		concurrencyGroupSet := !reader.Attr("concurrency_group").IsNull()
+		switch {
+		case concurrencySet && !concurrencyGroupSet:
+			diags = diags.Append(tfsdk.ValidationError(
+				cty.GetAttrPath("concurrency_group").NewErrorf("\"concurrency_group\" is required when \"concurrency\" is set"),
+			))
+		case concurrencyGroupSet && !concurrencySet:
+			diags = diags.Append(tfsdk.ValidationError(
+				cty.GetAttrPath("concurrency").NewErrorf("\"concurrency\" is required when \"concurrency_group\" is set"),
+			))
+		}
+		if !reader.Attr("soft_fail").IsNull() && !reader.Attr("soft_fail_exit_statuses").IsNull() {
+			diags = diags.Append(tfsdk.ValidationError(
+				cty.GetAttrPath("soft_fail_exit_statuses").NewErrorf("only one of \"soft_fail\" or \"soft_fail_exit_statuses\" may be set"),
+			))
+		}
+		diags = diags.Append(validateStepMatrix(reader))
+		moreDiags := validateNotifyBlocks(reader.BlockList("notify"), stepNotifyKinds, "steps")
+		diags = diags.Append(moreDiags.UnderPath(cty.GetAttrPath("notify")))
+
+	case "trigger":
+		if reader.Attr("trigger_pipeline").IsNull() {
+			diags = diags.Append(tfsdk.ValidationError(fmt.Errorf("\"trigger_pipeline\" argument is required for %q steps", stepType)))
+		}
+		diags = diags.Append(rejectStepArguments(reader, stepType, scriptStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, manualStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, waiterStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, "notify"))
+
+	case "manual":
+		diags = diags.Append(rejectStepArguments(reader, stepType, scriptStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, triggerStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, waiterStepArguments...))
+		diags = diags.Append(validateStepFieldBlocks(reader.BlockList("field")))
+		diags = diags.Append(rejectStepArguments(reader, stepType, "notify"))
+
+	case "waiter":
+		diags = diags.Append(rejectStepArguments(reader, stepType, scriptStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, triggerStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, manualStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, "branch_configuration"))
+		diags = diags.Append(rejectStepArguments(reader, stepType, "notify"))
+
+	case "group":
+		// The nested steps are validated by validateStepBlocks, since
+		// group steps are allowed only at the top level.
+		if reader.BlockCount("step") == 0 {
+			diags = diags.Append(tfsdk.ValidationError(fmt.Errorf("at least one nested \"step\" block is required for %q steps", stepType)))
+		}
+		diags = diags.Append(rejectStepArguments(reader, stepType, scriptStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, triggerStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, manualStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, waiterStepArguments...))
+		diags = diags.Append(rejectStepArguments(reader, stepType, "branch_configuration"))
+		moreDiags := validateNotifyBlocks(reader.BlockList("notify"), stepNotifyKinds, "steps")
+		diags = diags.Append(moreDiags.UnderPath(cty.GetAttrPath("notify")))
+
+	case "input":
+		diags = diags.Append(tfsdk.Diagnostic{
+			Severity: tfsdk.Error,
+			Summary:  "Unsupported step type",
+			Detail:   "Buildkite's REST API cannot create input steps, and would create a block step instead. Use a \"block\" step, or define the pipeline's steps with the steps_yaml argument.",
+			Path:     cty.GetAttrPath("type"),
+		})
+
+	case "":
+		diags = diags.Append(tfsdk.ValidationError(
+			cty.GetAttrPath("type").NewErrorf("empty string is not a valid step type"),
+		))
+	default:
+		diags = diags.Append(tfsdk.ValidationError(
+			cty.GetAttrPath("type").NewErrorf("%q is not a valid step type", stepType),
+		))
+	}
+
+	return diags
+}
+
+// These are the names of the arguments and nested block types that are
+// meaningful only for particular step types.
+var (
+	scriptStepArguments = []string{
+		"command", "commands", "env", "agent_query_rules", "agents",
+		"artifact_paths", "timeout_in_minutes", "parallelism",
+		"concurrency", "concurrency_group", "priority",
+		"soft_fail", "soft_fail_exit_statuses", "skip",
+		"cancel_on_build_failing", "retry", "plugin", "matrix",
+	}
+	triggerStepArguments = []string{"trigger_pipeline", "async", "build"}
+	manualStepArguments  = []string{"prompt", "blocked_state", "field"}
+	waiterStepArguments  = []string{"continue_on_failure"}
+)
+
+// stepTypeAliases maps the step type names used in Buildkite's pipeline YAML
+// to the equivalent names used in its REST API, which are the names we send
+// and the names we get back when reading a pipeline.
+//
+// The YAML names are the normal form of a step type in the state: a step
+// whose type is inferred, or that is read from the API without a
+// corresponding step in the configuration, has the YAML name. A type that is
+// set in the configuration is kept as written.
+//
+// The REST API has no type for input steps, and creating one as a manual
+// step would turn it into a block step, so input steps are rejected.
+var stepTypeAliases = map[string]string{
+	"command": "script",
+	"wait":    "waiter",
+	"block":   "manual",
+}
+
+// apiStepType returns the name used in Buildkite's REST API for the given
+// step type name, which may be either an API name or one of the aliases in
+// stepTypeAliases.
+func apiStepType(name string) string {
+	if apiName, ok := stepTypeAliases[name]; ok {
+		return apiName
+	}
+	return name
+}
+
+// yamlStepType is the inverse of apiStepType, returning the name used in
+// Buildkite's pipeline YAML for the given step type name.
+func yamlStepType(name string) string {
+	if yamlName, ok := yamlStepTypeNames[name]; ok {
+		return yamlName
+	}
+	return name
+}
+
+// stepTypeIndicators lists the arguments and nested block types that imply
+// the type of a step when its "type" argument is not set.
+var stepTypeIndicators = []struct {
+	name     string
+	stepType string
+}{
+	{"command", "command"},
+	{"commands", "command"},
+	{"plugin", "command"},
+	{"matrix", "command"},
+	{"trigger_pipeline", "trigger"},
+	{"prompt", "block"},
+	{"blocked_state", "block"},
+	{"field", "block"},
+	{"continue_on_failure", "wait"},
+	{"step", "group"},
+}
+
+// resolveStepTypes sets the planned "type" of each of the given step blocks,
+// and of the steps nested inside them, that does not have its type set in
+// the configuration. The diagnostics it returns have paths relative to the
+// list of step blocks.
+func resolveStepTypes(plans []tfobj.PlanBuilder) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	for i, plan := range plans {
+		if plan.Action() == tfobj.Delete {
+			continue
+		}
+		path := cty.IndexPath(cty.NumberIntVal(int64(i)))
+		diags = diags.Append(resolveStepType(plan).UnderPath(path))
+
+		if _, hasSteps := plan.Schema().NestedBlockTypes["step"]; hasSteps {
+			moreDiags := resolveStepTypes(plan.BlockPlanBuilderList("step"))
+			diags = diags.Append(moreDiags.UnderPath(path.Copy().GetAttr("step")))
+		}
+	}
+
+	return diags
+}
+
+func resolveStepType(plan tfobj.PlanBuilder) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	config := plan.ConfigReader()
+	if !config.Attr("type").IsNull() {
+		return diags
+	}
+	stepType, moreDiags := inferStepType(config)
+	diags = diags.Append(moreDiags)
+	if stepType != "" {
+		plan.SetAttr("type", cty.StringVal(stepType))
+	}
+	return diags
+}
+
+// inferStepType returns the type of step implied by the arguments set in the
+// given step block, or an empty string and an error diagnostic if the
+// arguments imply no type or more than one type.
+func inferStepType(reader tfobj.ObjectReader) (string, tfsdk.Diagnostics) {
+	var diags tfsdk.Diagnostics
+	var stepType, indicator string
+
+	for _, candidate := range stepTypeIndicators {
+		var set bool
+		if _, isBlock := reader.Schema().NestedBlockTypes[candidate.name]; isBlock {
+			set = reader.BlockCount(candidate.name) != 0
+		} else if _, isAttr := reader.Schema().Attributes[candidate.name]; isAttr {
+			set = !reader.Attr(candidate.name).IsNull()
+		}
+		switch {
+		case !set:
+			continue
+		case stepType == "":
+			stepType, indicator = candidate.stepType, candidate.name
+		case stepType != candidate.stepType:
+			diags = diags.Append(tfsdk.Diagnostic{
+				Severity: tfsdk.Error,
+				Summary:  "Ambiguous step type",
+				Detail:   fmt.Sprintf("The step type cannot be inferred, because %q implies a %q step but %q implies a %q step. Set the \"type\" argument to choose one.", indicator, stepType, candidate.name, candidate.stepType),
+				Path:     cty.GetAttrPath("type"),
+			})
+			return "", diags
+		}
+	}
+
+	if stepType == "" {
+		diags = diags.Append(tfsdk.Diagnostic{
+			Severity: tfsdk.Error,
+			Summary:  "Missing step type",
+			Detail:   "The step type cannot be inferred from the other arguments of this step, so the \"type\" argument is required.",
+			Path:     cty.GetAttrPath("type"),
+		})
+	}
+	return stepType, diags
+}
+
+// rejectStepArguments returns an error diagnostic for each of the given
+// argument or nested block type names that is set in the given step block.
+func rejectStepArguments(reader tfobj.ObjectReader, stepType string, names ...string) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	for _, name := range names {
+		var set bool
+		if _, isBlock := reader.Schema().NestedBlockTypes[name]; isBlock {
+			set = reader.BlockCount(name) != 0
+		} else {
+			set = !reader.Attr(name).IsNull()
+		}
+		if set {
+			diags = diags.Append(tfsdk.ValidationError(
+				cty.GetAttrPath(name).NewErrorf("%q is not used for %q steps", name, stepType),
+			))
+		}
+	}
+
+	return diags
+}
+
+// agentQueryRulesFromMap returns the agent query rules equivalent to the
+// given map of agent tags, in a consistent order.
+func agentQueryRulesFromMap(agents map[string]string) []string {
+	keys := make([]string, 0, len(agents))
+	for k := range agents {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	ret := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ret = append(ret, k+"="+agents[k])
+	}
+	return ret
+}
+
+// agentsFromQueryRules returns the map of agent tags equivalent to the given
+// agent query rules, or false if the rules cannot be represented as a map
+// because some of them are not of the form "key=value" or because they
+// repeat a key.
+func agentsFromQueryRules(rules []string) (map[string]string, bool) {
+	ret := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		eq := strings.Index(rule, "=")
+		if eq < 0 {
+			return nil, false
+		}
+		k, v := rule[:eq], rule[eq+1:]
+		if _, exists := ret[k]; exists {
+			return nil, false
+		}
+		ret[k] = v
+	}
+	return ret, true
+}
+
+// validateStepFieldBlocks checks the "field" blocks of a "manual" step. The
+// diagnostics it returns have paths relative to the step block.
+func validateStepFieldBlocks(readers []tfobj.ObjectReader) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	keys := make(map[string]int)
+	for i, reader := range readers {
+		path := cty.GetAttrPath("field").Index(cty.NumberIntVal(int64(i)))
+
+		keyVal := reader.Attr("key")
+		if keyVal.IsKnown() && !keyVal.IsNull() {
+			key := keyVal.AsString()
+			if prevIdx, exists := keys[key]; exists {
+				diags = diags.Append(stepArgumentError(path.GetAttr("key"), "duplicate field key %q; this key is already used by field %d", key, prevIdx))
+			} else {
+				keys[key] = i
+			}
+		}
+
+		isText := !reader.Attr("text").IsNull()
+		isSelect := !reader.Attr("select").IsNull()
+		switch {
+		case isText && isSelect:
+			diags = diags.Append(stepArgumentError(path, "only one of \"text\" or \"select\" may be set"))
+			continue
+		case !isText && !isSelect:
+			diags = diags.Append(stepArgumentError(path, "one of \"text\" or \"select\" must be set"))
+			continue
+		}
+
+		options := reader.BlockList("option")
+		if isText {
+			if len(options) != 0 {
+				diags = diags.Append(stepArgumentError(path.GetAttr("option"), "options are not used for text fields"))
+			}
+			if !reader.Attr("multiple").IsNull() {
+				diags = diags.Append(stepArgumentError(path.GetAttr("multiple"), "\"multiple\" is not used for text fields"))
+			}
+			if formatVal := reader.Attr("format"); formatVal.IsKnown() && !formatVal.IsNull() {
+				if _, err := regexp.Compile(formatVal.AsString()); err != nil {
+					diags = diags.Append(stepArgumentError(path.GetAttr("format"), "invalid regular expression: %s", err))
+				}
+			}
+			continue
+		}
+
+		// If we get here then we have a select field.
+		if !reader.Attr("format").IsNull() {
+			diags = diags.Append(stepArgumentError(path.GetAttr("format"), "\"format\" is not used for select fields"))
+		}
+		if len(options) == 0 {
+			diags = diags.Append(stepArgumentError(path, "a select field must have at least one \"option\" block"))
+			continue
+		}
+		values := make(map[string]struct{}, len(options))
+		for _, option := range options {
+			valueVal := option.Attr("value")
+			if !valueVal.IsKnown() || valueVal.IsNull() {
+				// Can't check the default until we know all of the values.
+				values = nil
+				break
+			}
+			values[valueVal.AsString()] = struct{}{}
+		}
+		if defaultVal := reader.Attr("default"); values != nil && defaultVal.IsKnown() && !defaultVal.IsNull() {
+			if _, ok := values[defaultVal.AsString()]; !ok {
+				diags = diags.Append(stepArgumentError(path.GetAttr("default"), "default value %q is not one of the values of this field's options", defaultVal.AsString()))
+			}
+		}
+	}
+
+	return diags
+}
+
+// validateStepJobCount is a ValidateFn for step arguments that give a number
+// of jobs.
+func validateStepJobCount(val int) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+	if val < 1 {
+		diags = diags.Append(tfsdk.ValidationError(
+			fmt.Errorf("must be at least one"),
+		))
+	}
+	return diags
+}
+
+func buildAPISkipFromMRT(skip *string) *apiSkip {
+	if skip == nil {
+		return nil
+	}
+	switch *skip {
+	case "true":
+		return &apiSkip{Skip: true}
+	case "false", "":
+		return &apiSkip{Skip: false}
+	default:
+		return &apiSkip{Skip: true, Reason: *skip}
+	}
+}
+
+func buildMRTSkipFromAPI(skip *apiSkip) *string {
+	if skip == nil || !skip.Skip {
+		return nil
+	}
+	reason := skip.Reason
+	if reason == "" {
+		reason = "true"
+	}
+	return &reason
+}
+
+func normalizeSkip(got **string, want *string) {
+	if *got == nil && want != nil && (*want == "false" || *want == "") {
+		*got = want
+	}
+}
+
+// stepArgumentError is like tfsdk.ValidationError for a cty.PathError, but
+// doesn't repeat the path in the message. The path is reported separately
+// anyway, and tfsdk can't currently format paths that include list indices.
+func stepArgumentError(path cty.Path, format string, args ...interface{}) tfsdk.Diagnostic {
+	return tfsdk.Diagnostic{
+		Severity: tfsdk.Error,
+		Summary:  "Unsuitable argument value",
+		Detail:   fmt.Sprintf("This value cannot be used: %s.", fmt.Sprintf(format, args...)),
+		Path:     path,
+	}
+}
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/apparentlymart/terraform-sdk/tftest"
@@ -33,4 +34,1393 @@ resource "buildkite_pipeline" "test" {
 
 		// TODO: Check the state, once the tftest package allows that.
 	})
+	t.Run("update", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type = "waiter"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo renamed"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		command = "echo hello"
+	}
+}
+`)
+
+		wd.RequireApply(t)
+	})
+	t.Run("step env and agent rules", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		command = "echo $GREETING"
+		env = {
+			GREETING = "hello"
+		}
+		agent_query_rules = ["queue=default"]
+	}
+	step {
+		type    = "script"
+		command = "echo empty"
+		env     = {}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("pipeline settings", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	description                      = "Testing pipeline settings"
+	default_branch                   = "master"
+	branch_configuration             = "master feature/*"
+	skip_queued_branch_builds        = true
+	skip_queued_branch_builds_filter = "!master"
+	default_timeout_in_minutes       = 10
+	maximum_timeout_in_minutes       = 60
+	visibility                       = "private"
+
+	step {
+		type = "waiter"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type = "waiter"
+	}
+}
+`)
+
+		wd.RequireApply(t)
+	})
+	t.Run("provider settings", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	provider_settings {
+		trigger_mode               = "code"
+		build_pull_requests        = true
+		pull_request_branch_filter = "master"
+		build_tags                 = false
+		filter_condition           = "build.branch == 'master'"
+	}
+
+	step {
+		type = "waiter"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+
+		// Removing the filters must turn them off again.
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	provider_settings {
+		trigger_mode        = "code"
+		build_pull_requests = true
+		build_tags          = false
+	}
+
+	step {
+		type = "waiter"
+	}
+}
+`)
+		wd.RequireApply(t)
+	})
+	t.Run("provider settings for wrong host", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git@gitlab.com:example/example.git"
+
+	provider_settings {
+		trigger_mode = "code"
+	}
+
+	step {
+		type = "waiter"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), "Unsupported provider setting"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("trigger step", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "deploy" {
+	name = "foo deploy"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type = "waiter"
+	}
+}
+
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type             = "trigger"
+		trigger_pipeline = buildkite_pipeline.deploy.slug
+		async            = true
+
+		build {
+			message = "Deploying"
+			branch  = "master"
+			env = {
+				STAGE = "production"
+			}
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("manual step fields", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type          = "manual"
+		label         = "Release"
+		prompt        = "Fill out the release details"
+		blocked_state = "running"
+
+		field {
+			text     = "Release name"
+			key      = "release-name"
+			hint     = "For example, v1.2.0"
+			format   = "v[0-9]+\\.[0-9]+\\.[0-9]+"
+			required = false
+		}
+		field {
+			select  = "Stream"
+			key     = "release-stream"
+			default = "beta"
+
+			option {
+				label = "Beta"
+				value = "beta"
+			}
+			option {
+				label = "Stable"
+				value = "stable"
+			}
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("manual step invalid fields", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type = "manual"
+
+		field {
+			select  = "Stream"
+			key     = "release-stream"
+			default = "nightly"
+
+			option {
+				label = "Beta"
+				value = "beta"
+			}
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), "is not one of the values"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("script step options", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type                    = "script"
+		command                 = "make test"
+		artifact_paths          = ["coverage/*", "log/*.log"]
+		branch_configuration    = "master"
+		timeout_in_minutes      = 30
+		parallelism             = 4
+		concurrency             = 1
+		concurrency_group       = "foo/test"
+		priority                = 2
+		soft_fail_exit_statuses = [42]
+		cancel_on_build_failing = true
+	}
+	step {
+		type      = "script"
+		command   = "make lint"
+		soft_fail = true
+		skip      = "Lint is temporarily disabled"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("script step retry", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		command = "make test"
+
+		retry {
+			automatic {
+				exit_status = "*"
+				limit       = 2
+			}
+			automatic {
+				signal_reason = "agent_stop"
+				limit         = 3
+			}
+			manual {
+				permit_on_passed = true
+			}
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("script step retry limit too high", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		command = "make test"
+
+		retry {
+			automatic {
+				limit = 11
+			}
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), "must be between 1 and 10"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("script step plugins", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		command = "make test"
+
+		plugin {
+			source = "docker-compose#v4.0.0"
+			config = jsonencode({
+				run    = "app"
+				config = ["docker-compose.yml", "docker-compose.test.yml"]
+			})
+		}
+		plugin {
+			source = "artifacts#v1.3.0"
+			config = <<EOT
+{"upload": "log/*.log"}
+EOT
+		}
+	}
+	step {
+		type = "script"
+
+		plugin {
+			source = "docker#v3.3.0"
+			config = jsonencode({
+				image = "golang:1.12"
+			})
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("step dependencies", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		key     = "build"
+		command = "make"
+	}
+	step {
+		type    = "script"
+		key     = "lint"
+		command = "make lint"
+	}
+	step {
+		type    = "script"
+		command = "make test"
+		if      = "build.branch == 'master'"
+
+		depends_on {
+			step = "build"
+		}
+		depends_on {
+			step          = "lint"
+			allow_failure = true
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("step dependency cycle", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		key     = "a"
+		command = "true"
+
+		depends_on {
+			step = "b"
+		}
+	}
+	step {
+		type    = "script"
+		key     = "b"
+		command = "true"
+
+		depends_on {
+			step = "a"
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), "Step dependency cycle"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("group step", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		key     = "build"
+		command = "make"
+	}
+	step {
+		type  = "group"
+		key   = "tests"
+		label = "Tests"
+
+		depends_on {
+			step = "build"
+		}
+
+		step {
+			type    = "script"
+			command = "make test-unit"
+		}
+		step {
+			type    = "script"
+			command = "make test-integration"
+		}
+	}
+	step {
+		type    = "script"
+		command = "make release"
+
+		depends_on {
+			step = "tests"
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("nested group step", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type = "group"
+
+		step {
+			type = "group"
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), "Nested group step"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("group notify", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type  = "group"
+		key   = "deploy"
+		label = "Deploy"
+
+		notify {
+			slack {
+				channels = ["#deploys"]
+			}
+		}
+		notify {
+			github_commit_status {
+				context = "deploy"
+			}
+		}
+
+		step {
+			type    = "script"
+			command = "make deploy"
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("matrix step", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		label   = "Lint {{matrix}}"
+		command = "make lint-{{matrix}}"
+
+		matrix {
+			values = ["go", "docs"]
+		}
+	}
+	step {
+		type              = "script"
+		label             = "Test {{matrix.os}}/{{matrix.arch}}"
+		command           = "make test GOOS={{matrix.os}} GOARCH={{matrix.arch}}"
+		agent_query_rules = ["os={{matrix.os}}"]
+
+		matrix {
+			setup = {
+				os   = ["linux", "darwin", "windows"]
+				arch = ["amd64", "arm64"]
+			}
+
+			adjustment {
+				with = {
+					os   = "windows"
+					arch = "arm64"
+				}
+				skip = "Not supported yet"
+			}
+			adjustment {
+				with = {
+					os   = "darwin"
+					arch = "arm64"
+				}
+				soft_fail = true
+			}
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("matrix step undefined dimension", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		command = "make test GOOS={{matrix.os}} GOARCH={{matrix.arch}}"
+
+		matrix {
+			setup = {
+				os = ["linux", "darwin"]
+			}
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), "Invalid matrix reference"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("notify", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	notify {
+		email = "builds@example.com"
+		if    = "build.state == 'failed'"
+	}
+	notify {
+		slack {
+			channels = ["#builds"]
+			message  = "Build finished"
+		}
+	}
+
+	step {
+		type    = "script"
+		command = "make test"
+
+		notify {
+			github_commit_status {
+				context = "test"
+			}
+		}
+	}
+	step {
+		type  = "group"
+		label = "Deploy"
+
+		notify {
+			slack {
+				channels = ["#deploys"]
+			}
+		}
+
+		step {
+			type    = "script"
+			command = "make deploy"
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("notify email on step", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		command = "make test"
+
+		notify {
+			email = "builds@example.com"
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), "Unsupported notification"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("steps yaml", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	steps_yaml = <<EOT
+steps:
+  - label: Test
+    command: make test
+  - wait
+  - block: Release?
+  - label: Release
+    command: make release
+EOT
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("steps yaml replaced by step blocks", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	steps_yaml = <<EOT
+steps:
+  - label: Test
+    command: make test
+EOT
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+
+		// The YAML configuration must be cleared, or else Buildkite would
+		// still return the steps from the YAML after this update.
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		label   = "Build"
+		command = "make"
+	}
+}
+`)
+
+		wd.RequireApply(t)
+	})
+	t.Run("steps yaml with step blocks", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	steps_yaml = "steps: [wait]"
+
+	step {
+		type = "waiter"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), "Conflicting pipeline steps"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("steps yaml rendered from step blocks", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		label   = "Test"
+		command = "make test"
+	}
+	step {
+		type = "waiter"
+	}
+}
+
+resource "buildkite_pipeline" "copy" {
+	name = "foo-copy"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	steps_yaml = buildkite_pipeline.test.steps_yaml
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("step type aliases and inference", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "command"
+		command = "make test"
+	}
+	step {
+		type = "wait"
+	}
+	step {
+		prompt = "Release?"
+	}
+	step {
+		type   = "block"
+		prompt = "Deploy?"
+	}
+	step {
+		label   = "Release"
+		command = "make release"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("input step", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type   = "input"
+		prompt = "Release notes"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), "Unsupported step type"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("ambiguous step type", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		command          = "make test"
+		trigger_pipeline = "deploy"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), "Ambiguous step type"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("wait step options", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		key     = "test"
+		command = "make test"
+	}
+	step {
+		type                = "waiter"
+		continue_on_failure = true
+		if                  = "build.branch == \"main\""
+
+		depends_on {
+			step = "test"
+		}
+	}
+	step {
+		type    = "script"
+		command = "make report"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("wait step with script options", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type     = "waiter"
+		priority = 1
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), `"priority" is not used for "waiter" steps`; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("step commands and agents", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type = "script"
+		commands = [
+			"make",
+			"make test",
+		]
+		agents = {
+			queue = "test"
+			os    = "linux"
+		}
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("step command and commands", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type     = "script"
+		command  = "make"
+		commands = ["make test"]
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), `only one of "command" or "commands" may be set`; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("explicit organization", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+data "buildkite_organization" "current" {
+}
+
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+	organization = data.buildkite_organization.current.slug
+
+	step {
+		type    = "script"
+		command = "make test"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("non-existent organization", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+	organization = "xyz-does-not-exist"
+
+	step {
+		type    = "script"
+		command = "make test"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), "Buildkite organization not found"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("predicted slug and urls", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "deploy" {
+	name = "Foo Deploy"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		command = "make deploy"
+	}
+}
+
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+	description = "Deploys with ${buildkite_pipeline.deploy.web_url}"
+
+	step {
+		type    = "script"
+		command = "make test"
+	}
+	step {
+		type             = "trigger"
+		trigger_pipeline = buildkite_pipeline.deploy.slug
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+	})
+	t.Run("slug already taken", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		command = "make test"
+	}
+}
+
+resource "buildkite_pipeline" "duplicate" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		command = "make test"
+	}
+
+	depends_on = [buildkite_pipeline.test]
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), "set adopt_existing = true"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+	t.Run("deletion protection", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+	deletion_protection = true
+
+	step {
+		type    = "script"
+		command = "make test"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+
+		wd.RequireSetConfig(t, `// empty for destroy`)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("destroy succeeded; want error")
+		}
+		if got, want := err.Error(), "Pipeline is protected from deletion"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+
+	step {
+		type    = "script"
+		command = "make test"
+	}
+}
+`)
+		wd.RequireApply(t)
+	})
+	t.Run("archive on destroy", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+	on_destroy = "archive"
+
+	step {
+		type    = "script"
+		command = "make test"
+	}
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+
+		// Destroying the pipeline archives it, so we must adopt it again to
+		// delete it.
+		wd.RequireSetConfig(t, `// empty for destroy`)
+		wd.RequireApply(t)
+		wd.RequireSetConfig(t, `
+resource "buildkite_pipeline" "test" {
+	name = "foo"
+	repository = "git://github.com/apparentlymart/terraform-sdk.git"
+	adopt_existing = true
+
+	step {
+		type    = "script"
+		command = "make test"
+	}
+}
+`)
+		wd.RequireApply(t)
+	})
 }
@@ -0,0 +1,383 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	tfsdk "github.com/apparentlymart/terraform-sdk"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/gocty"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// yamlStepTypeKeys maps each of the keys that identify the type of a step in
+// Buildkite's pipeline YAML to the canonical name of the type, which we use
+// when comparing steps.
+var yamlStepTypeKeys = map[string]string{
+	"command":  "command",
+	"commands": "command",
+	"wait":     "wait",
+	"waiter":   "wait",
+	"block":    "block",
+	"manual":   "block",
+	"input":    "input",
+	"trigger":  "trigger",
+	"group":    "group",
+}
+
+// yamlStepTypeKeyOrder is the order in which we check for the keys in
+// yamlStepTypeKeys, so that our error messages are consistent.
+var yamlStepTypeKeyOrder = []string{
+	"command", "commands", "wait", "waiter", "block", "manual", "input", "trigger", "group",
+}
+
+// yamlStepTypeNames maps the values that Buildkite accepts for the "type" key
+// of a step, including the legacy names used in its REST API, to the
+// canonical name of the type.
+var yamlStepTypeNames = map[string]string{
+	"command": "command",
+	"script":  "command",
+	"wait":    "wait",
+	"waiter":  "wait",
+	"block":   "block",
+	"manual":  "block",
+	"input":   "input",
+	"trigger": "trigger",
+	"group":   "group",
+}
+
+// validateStepsYAML checks that the given string is a valid Buildkite
+// pipeline definition in YAML or JSON syntax. The diagnostics it returns have
+// paths relative to the steps_yaml argument.
+func validateStepsYAML(src string) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	if _, err := canonicalStepsYAML(src); err != nil {
+		diags = diags.Append(tfsdk.Diagnostic{
+			Severity: tfsdk.Error,
+			Summary:  "Invalid pipeline steps YAML",
+			Detail:   fmt.Sprintf("The steps_yaml value is not a valid Buildkite pipeline definition: %s.", err),
+		})
+	}
+
+	return diags
+}
+
+// stepsYAMLEquivalent returns true if the two given strings are both valid
+// pipeline definitions that differ only in ways that Buildkite ignores, such
+// as whitespace, key order, and the choice between equivalent names for step
+// types.
+func stepsYAMLEquivalent(a, b string) bool {
+	av, err := canonicalStepsYAML(a)
+	if err != nil {
+		return false
+	}
+	bv, err := canonicalStepsYAML(b)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+// canonicalStepsYAML parses the given pipeline definition and returns a
+// normalized representation of it, suitable only for comparisons.
+//
+// The definition can be either a list of steps or a mapping with a "steps"
+// key, as for the "buildkite-agent pipeline upload" command. Since JSON is a
+// subset of YAML, JSON syntax is accepted too.
+func canonicalStepsYAML(src string) (map[string]interface{}, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal([]byte(src), &raw); err != nil {
+		return nil, err
+	}
+	raw = normalizeYAMLValue(raw)
+
+	var ret map[string]interface{}
+	switch raw := raw.(type) {
+	case []interface{}:
+		ret = map[string]interface{}{"steps": raw}
+	case map[string]interface{}:
+		ret = raw
+	default:
+		return nil, fmt.Errorf("must be either a list of steps or a mapping with a \"steps\" key")
+	}
+
+	rawSteps, ok := ret["steps"].([]interface{})
+	if !ok || len(rawSteps) == 0 {
+		return nil, fmt.Errorf("must have at least one step")
+	}
+	steps, err := canonicalYAMLSteps(rawSteps, "steps", true)
+	if err != nil {
+		return nil, err
+	}
+	ret["steps"] = steps
+	return ret, nil
+}
+
+func canonicalYAMLSteps(raws []interface{}, path string, allowGroups bool) ([]interface{}, error) {
+	ret := make([]interface{}, len(raws))
+	for i, raw := range raws {
+		stepPath := fmt.Sprintf("%s[%d]", path, i)
+		step, err := canonicalYAMLStep(raw, stepPath)
+		if err != nil {
+			return nil, err
+		}
+		if step["type"] == "group" {
+			if !allowGroups {
+				return nil, fmt.Errorf("%s: a group step cannot contain another group step", stepPath)
+			}
+			children, ok := step["steps"].([]interface{})
+			if !ok || len(children) == 0 {
+				return nil, fmt.Errorf("%s: a group step must have at least one nested step", stepPath)
+			}
+			step["steps"], err = canonicalYAMLSteps(children, stepPath+".steps", false)
+			if err != nil {
+				return nil, err
+			}
+		}
+		ret[i] = step
+	}
+	return ret, nil
+}
+
+func canonicalYAMLStep(raw interface{}, path string) (map[string]interface{}, error) {
+	switch raw := raw.(type) {
+	case string:
+		// Some step types can be given as just their name, without any
+		// other settings.
+		switch stepType := yamlStepTypeNames[raw]; stepType {
+		case "wait", "block", "input":
+			return map[string]interface{}{"type": stepType}, nil
+		default:
+			return nil, fmt.Errorf("%s: %q is not a valid step", path, raw)
+		}
+
+	case map[string]interface{}:
+		step := make(map[string]interface{}, len(raw))
+		for k, v := range raw {
+			step[k] = v
+		}
+
+		var stepType string
+		if rawType, exists := step["type"]; exists {
+			name, _ := rawType.(string)
+			stepType = yamlStepTypeNames[name]
+			if stepType == "" {
+				return nil, fmt.Errorf("%s: %v is not a valid step type", path, rawType)
+			}
+			delete(step, "type")
+		}
+
+		var typeKey string
+		for _, key := range yamlStepTypeKeyOrder {
+			v, exists := step[key]
+			if !exists {
+				continue
+			}
+			keyType := yamlStepTypeKeys[key]
+			if typeKey != "" && yamlStepTypeKeys[typeKey] != keyType {
+				return nil, fmt.Errorf("%s: step type is ambiguous, because it has both %q and %q", path, typeKey, key)
+			}
+			if stepType != "" && stepType != keyType {
+				return nil, fmt.Errorf("%s: a %q key cannot be used in a %s step", path, key, stepType)
+			}
+			typeKey, stepType = key, keyType
+			delete(step, key)
+
+			switch keyType {
+			case "command":
+				// "command" and "commands" are interchangeable, and each
+				// can be either a single string or a list.
+				if s, isStr := v.(string); isStr {
+					v = []interface{}{s}
+				}
+				step["command"] = v
+			case "trigger":
+				step["trigger"] = v
+			default:
+				// For the other types, the value of the type key is the
+				// step's label.
+				if v != nil {
+					step["label"] = v
+				}
+			}
+		}
+		if _, hasPlugins := step["plugins"]; hasPlugins && stepType == "" {
+			// A step with plugins but no command is a command step too.
+			stepType = "command"
+		}
+		if stepType == "" {
+			return nil, fmt.Errorf("%s: cannot determine the type of this step", path)
+		}
+		if name, exists := step["name"]; exists {
+			if _, hasLabel := step["label"]; !hasLabel {
+				step["label"] = name
+			}
+			delete(step, "name")
+		}
+		step["type"] = stepType
+		return step, nil
+
+	default:
+		return nil, fmt.Errorf("%s: each step must be either a mapping or a string", path)
+	}
+}
+
+// normalizeYAMLValue converts the mappings in the given value as returned by
+// the YAML parser, which can have keys of any type, to have string keys.
+func normalizeYAMLValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		ret := make(map[string]interface{}, len(v))
+		for k, ev := range v {
+			ret[fmt.Sprint(k)] = normalizeYAMLValue(ev)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for i, ev := range v {
+			ret[i] = normalizeYAMLValue(ev)
+		}
+		return ret
+	default:
+		return v
+	}
+}
+
+// renderStepsYAML returns the given steps in Buildkite's pipeline YAML
+// format, as accepted by "buildkite-agent pipeline upload", with the keys of
+// each step in a consistent order.
+//
+// The result is derived from the same request objects that we send to the
+// Buildkite API, so it describes the steps exactly as Buildkite stores them.
+// It is nil only if the steps cannot be serialized, which should not happen
+// for steps that passed validation.
+func renderStepsYAML(steps []pipelineMRTStep) *string {
+	rendered, err := yamlStepsFromAPI(buildAPIStepsFromMRT(steps))
+	if err != nil {
+		return nil
+	}
+	buf, err := yaml.Marshal(map[string]interface{}{"steps": rendered})
+	if err != nil {
+		return nil
+	}
+	ret := string(buf)
+	return &ret
+}
+
+func yamlStepsFromAPI(steps []*apiStep) ([]interface{}, error) {
+	ret := make([]interface{}, len(steps))
+	for i, step := range steps {
+		rendered, err := yamlStepFromAPI(step)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = rendered
+	}
+	return ret, nil
+}
+
+// yamlStepFromAPI converts the given step from the form used in Buildkite's
+// REST API to the form used in its pipeline YAML.
+//
+// Most of the settings have the same name and structure in both, so we start
+// from the JSON serialization of the step, which already takes care of the
+// various settings that have more than one possible representation, and
+// then rewrite only the settings that differ.
+func yamlStepFromAPI(step *apiStep) (map[string]interface{}, error) {
+	buf, err := json.Marshal(step)
+	if err != nil {
+		return nil, err
+	}
+	var ret map[string]interface{}
+	if err := json.Unmarshal(buf, &ret); err != nil {
+		return nil, err
+	}
+
+	move := func(from, to string) {
+		if v, exists := ret[from]; exists {
+			delete(ret, from)
+			ret[to] = v
+		}
+	}
+
+	delete(ret, "type")
+	move("branch_configuration", "branches")
+	if len(step.AgentQueryRules) != 0 {
+		if agents, ok := agentsFromQueryRules(step.AgentQueryRules); ok {
+			ret["agent_query_rules"] = agents
+		}
+		move("agent_query_rules", "agents")
+	}
+
+	var stepType string
+	if step.Type != nil {
+		stepType = *step.Type
+	}
+	switch stepType {
+	case "script":
+		move("name", "label")
+		if step.ArtifactPaths != nil {
+			ret["artifact_paths"] = strings.Split(*step.ArtifactPaths, ";")
+		}
+		if step.Command == nil && len(step.Plugins) == 0 {
+			ret["command"] = nil
+		}
+
+	case "waiter":
+		delete(ret, "name")
+		ret["wait"] = nil
+
+	case "manual":
+		delete(ret, "name")
+		ret["block"] = step.Name
+
+	case "trigger":
+		move("name", "label")
+		delete(ret, "trigger_project_slug")
+		ret["trigger"] = step.TriggerProjectSlug
+		move("trigger_async", "async")
+		build := make(map[string]interface{})
+		for _, name := range []string{"message", "commit", "branch", "env", "meta_data"} {
+			if v, exists := ret["trigger_"+name]; exists {
+				delete(ret, "trigger_"+name)
+				build[name] = v
+			}
+		}
+		if len(build) != 0 {
+			ret["build"] = build
+		}
+
+	case "group":
+		children, err := yamlStepsFromAPI(step.Steps)
+		if err != nil {
+			return nil, err
+		}
+		ret["steps"] = children
+
+	default:
+		return nil, fmt.Errorf("unsupported step type %q", stepType)
+	}
+
+	return ret, nil
+}
+
+// planStepsYAML returns the planned value for steps_yaml when a pipeline's
+// steps are given as the given list of step block values, which is unknown
+// if any of the steps are not yet known.
+func planStepsYAML(stepsVal cty.Value) cty.Value {
+	if !stepsVal.IsWhollyKnown() {
+		return cty.UnknownVal(cty.String)
+	}
+	var steps []pipelineMRTStep
+	if err := gocty.FromCtyValue(stepsVal, &steps); err != nil {
+		return cty.UnknownVal(cty.String)
+	}
+	rendered := renderStepsYAML(steps)
+	if rendered == nil {
+		return cty.UnknownVal(cty.String)
+	}
+	return cty.StringVal(*rendered)
+}
@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestRenderStepsYAML(t *testing.T) {
+	str := func(s string) *string { return &s }
+	yes := true
+
+	steps := []pipelineMRTStep{
+		{
+			Type:          "command",
+			Label:         str(":hammer: Build"),
+			Key:           str("build"),
+			Command:       str("make"),
+			Agents:        &map[string]string{"queue": "builders"},
+			ArtifactPaths: &[]string{"dist/*", "logs/*"},
+		},
+		{
+			Type:              "wait",
+			ContinueOnFailure: &yes,
+		},
+		{
+			Type:   "block",
+			Label:  str(":rocket: Release"),
+			Prompt: str("Release this build?"),
+		},
+		{
+			Type:            "trigger",
+			Label:           str("Deploy"),
+			TriggerPipeline: str("deploy"),
+			Async:           &yes,
+			Build: &pipelineMRTTriggerBuild{
+				Message: str("Deploying"),
+				Branch:  str("main"),
+				Env:     &map[string]string{"STAGE": "production"},
+			},
+		},
+		{
+			Type:  "group",
+			Label: str("Checks"),
+			Steps: []pipelineMRTStep{
+				{
+					Type:    "command",
+					Label:   str("Lint"),
+					Command: str("make lint"),
+				},
+			},
+		},
+	}
+
+	got := renderStepsYAML(steps)
+	if got == nil {
+		t.Fatalf("renderStepsYAML returned nil")
+	}
+	if _, err := canonicalStepsYAML(*got); err != nil {
+		t.Fatalf("rendered YAML is not a valid pipeline definition: %s\n%s", err, *got)
+	}
+
+	// The keys of each step are sorted, so this must match exactly.
+	want := `steps:
+- agents:
+    queue: builders
+  artifact_paths:
+  - dist/*
+  - logs/*
+  command: make
+  key: build
+  label: ':hammer: Build'
+- continue_on_failure: true
+  wait: null
+- block: ':rocket: Release'
+  prompt: Release this build?
+- async: true
+  build:
+    branch: main
+    env:
+      STAGE: production
+    message: Deploying
+  label: Deploy
+  trigger: deploy
+- group: Checks
+  steps:
+  - command: make lint
+    label: Lint
+`
+	if *got != want {
+		t.Errorf("wrong result\ngot:\n%s\nwant:\n%s", *got, want)
+	}
+}
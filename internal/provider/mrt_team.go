@@ -0,0 +1,296 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	tfsdk "github.com/apparentlymart/terraform-sdk"
+	"github.com/apparentlymart/terraform-sdk/tfobj"
+	"github.com/apparentlymart/terraform-sdk/tfschema"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type teamMRT struct {
+	ID   *string `cty:"id"`
+	UUID *string `cty:"uuid"`
+	Name string  `cty:"name"`
+	Slug *string `cty:"slug"`
+
+	Description               *string `cty:"description"`
+	Privacy                   *string `cty:"privacy"`
+	IsDefaultTeam             *bool   `cty:"is_default_team"`
+	DefaultMemberRole         *string `cty:"default_member_role"`
+	MembersCanCreatePipelines *bool   `cty:"members_can_create_pipelines"`
+
+	Organization *string `cty:"organization"`
+}
+
+// These are the values that Buildkite uses for teams that don't specify
+// privacy or a default member role.
+const (
+	defaultTeamPrivacy    = "VISIBLE"
+	defaultTeamMemberRole = "MEMBER"
+)
+
+func teamManagedResourceType() tfsdk.ManagedResourceType {
+	return tfsdk.NewManagedResourceType(&tfsdk.ResourceTypeDef{
+		ConfigSchema: &tfschema.BlockType{
+			Attributes: map[string]*tfschema.Attribute{
+				"name": {
+					Type:     cty.String,
+					Required: true,
+				},
+
+				"description": {
+					Type:     cty.String,
+					Optional: true,
+				},
+				"privacy": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "Either \"VISIBLE\", so that all members of the organization can see the team, or \"SECRET\". Defaults to \"VISIBLE\".",
+
+					ValidateFn: func(val string) tfsdk.Diagnostics {
+						var diags tfsdk.Diagnostics
+						switch val {
+						case "VISIBLE", "SECRET":
+							// Okay
+						default:
+							diags = diags.Append(tfsdk.ValidationError(
+								fmt.Errorf("must be either \"VISIBLE\" or \"SECRET\""),
+							))
+						}
+						return diags
+					},
+				},
+				"is_default_team": {
+					Type:        cty.Bool,
+					Optional:    true,
+					Description: "If true, new members of the organization are automatically added to the team.",
+				},
+				"default_member_role": {
+					Type:        cty.String,
+					Optional:    true,
+					Description: "The role given to users who are added to the team: either \"MEMBER\" or \"MAINTAINER\". Defaults to \"MEMBER\".",
+
+					ValidateFn: func(val string) tfsdk.Diagnostics {
+						var diags tfsdk.Diagnostics
+						switch val {
+						case "MEMBER", "MAINTAINER":
+							// Okay
+						default:
+							diags = diags.Append(tfsdk.ValidationError(
+								fmt.Errorf("must be either \"MEMBER\" or \"MAINTAINER\""),
+							))
+						}
+						return diags
+					},
+				},
+				"members_can_create_pipelines": {
+					Type:     cty.Bool,
+					Optional: true,
+				},
+				"organization": {
+					Type:        cty.String,
+					Optional:    true,
+					Computed:    true,
+					Description: "Slug of the organization to create the team in. If not specified, then the organization slug configured in the provider is used.",
+
+					ValidateFn: func(val string) tfsdk.Diagnostics {
+						var diags tfsdk.Diagnostics
+						if val == "" {
+							diags = diags.Append(tfsdk.ValidationError(
+								fmt.Errorf("an organization slug must not be empty"),
+							))
+						}
+						return diags
+					},
+				},
+
+				"id": {
+					Type:     cty.String,
+					Computed: true,
+				},
+				"uuid": {
+					Type:     cty.String,
+					Computed: true,
+				},
+				"slug": {
+					Type:     cty.String,
+					Computed: true,
+				},
+			},
+		},
+		PlanFn: func(ctx context.Context, meta *Meta, plan tfobj.PlanBuilder) (cty.Value, cty.PathSet, tfsdk.Diagnostics) {
+			var diags tfsdk.Diagnostics
+
+			diags = diags.Append(planOrganization(meta, plan))
+			if diags.HasErrors() {
+				return plan.ObjectVal(), plan.RequiresReplace(), diags
+			}
+
+			// Buildkite derives a team's slug from its name.
+			if plan.Action() != tfobj.Create && attrHasChange(plan, "name") {
+				plan.SetAttrUnknown("slug")
+			}
+
+			return plan.ObjectVal(), plan.RequiresReplace(), diags
+		},
+
+		CreateFn: func(ctx context.Context, meta *Meta, obj *teamMRT) (*teamMRT, tfsdk.Diagnostics) {
+			var diags tfsdk.Diagnostics
+
+			client, moreDiags := meta.apiClient()
+			diags = diags.Append(moreDiags)
+			if diags.HasErrors() {
+				return obj, diags
+			}
+
+			orgID, resp, err := getOrganizationGraphQLID(client, *obj.Organization)
+			diags = diags.Append(graphQLWriteErrors(resp, err))
+			if diags.HasErrors() {
+				return obj, diags
+			}
+			if orgID == nil {
+				diags = diags.Append(tfsdk.Diagnostic{
+					Severity: tfsdk.Error,
+					Summary:  "Buildkite organization not found",
+					Detail:   fmt.Sprintf("Cannot find organization %q. Either the organization does not exist or your current API credentials do not have API access to it.", *obj.Organization),
+					Path:     cty.GetAttrPath("organization"),
+				})
+				return obj, diags
+			}
+
+			team := buildAPITeamFromMRT(obj)
+			team.OrganizationID = orgID
+			created, resp, err := createTeam(client, team)
+			diags = diags.Append(graphQLWriteErrors(resp, err))
+			if diags.HasErrors() {
+				return obj, diags
+			}
+
+			return normalizeMRTTeamEmpties(buildMRTTeamFromAPI(created, *obj.Organization), obj), diags
+		},
+
+		ReadFn: func(ctx context.Context, meta *Meta, obj *teamMRT) (*teamMRT, tfsdk.Diagnostics) {
+			var diags tfsdk.Diagnostics
+
+			client, moreDiags := meta.apiClient()
+			diags = diags.Append(moreDiags)
+			if diags.HasErrors() {
+				return obj, diags
+			}
+
+			read, resp, err := getTeam(client, *obj.ID)
+			diags = diags.Append(graphQLWriteErrors(resp, err))
+			if diags.HasErrors() {
+				return obj, diags
+			}
+			if read == nil {
+				return nil, diags
+			}
+
+			return normalizeMRTTeamEmpties(buildMRTTeamFromAPI(read, *obj.Organization), obj), diags
+		},
+
+		UpdateFn: func(ctx context.Context, meta *Meta, prior, new *teamMRT) (*teamMRT, tfsdk.Diagnostics) {
+			var diags tfsdk.Diagnostics
+
+			client, moreDiags := meta.apiClient()
+			diags = diags.Append(moreDiags)
+			if diags.HasErrors() {
+				return prior, diags
+			}
+
+			updated, resp, err := updateTeam(client, *prior.ID, buildAPITeamFromMRT(new))
+			diags = diags.Append(graphQLWriteErrors(resp, err))
+			if diags.HasErrors() {
+				return prior, diags
+			}
+
+			return normalizeMRTTeamEmpties(buildMRTTeamFromAPI(updated, *prior.Organization), new), diags
+		},
+
+		DeleteFn: func(ctx context.Context, meta *Meta, obj *teamMRT) (*teamMRT, tfsdk.Diagnostics) {
+			var diags tfsdk.Diagnostics
+
+			client, moreDiags := meta.apiClient()
+			diags = diags.Append(moreDiags)
+			if diags.HasErrors() {
+				return obj, diags
+			}
+
+			resp, err := deleteTeam(client, *obj.ID)
+			diags = diags.Append(graphQLWriteErrors(resp, err))
+			if diags.HasErrors() {
+				return obj, diags
+			}
+
+			return nil, diags
+		},
+	})
+}
+
+func buildAPITeamFromMRT(obj *teamMRT) *apiTeam {
+	privacy := defaultTeamPrivacy
+	if obj.Privacy != nil {
+		privacy = *obj.Privacy
+	}
+	role := defaultTeamMemberRole
+	if obj.DefaultMemberRole != nil {
+		role = *obj.DefaultMemberRole
+	}
+
+	return &apiTeam{
+		Name: &obj.Name,
+
+		// We send Buildkite's defaults for any unset settings, so that
+		// removing one from the configuration resets it in Buildkite.
+		Description:               stringOrEmpty(obj.Description),
+		Privacy:                   &privacy,
+		IsDefaultTeam:             boolOrFalse(obj.IsDefaultTeam),
+		DefaultMemberRole:         &role,
+		MembersCanCreatePipelines: boolOrFalse(obj.MembersCanCreatePipelines),
+	}
+}
+
+func buildMRTTeamFromAPI(team *apiTeam, orgSlug string) *teamMRT {
+	return &teamMRT{
+		ID:   team.ID,
+		UUID: team.UUID,
+		Name: *team.Name,
+		Slug: team.Slug,
+
+		Description:               nonEmptyString(team.Description),
+		Privacy:                   nonDefaultString(team.Privacy, defaultTeamPrivacy),
+		IsDefaultTeam:             trueOrNil(team.IsDefaultTeam),
+		DefaultMemberRole:         nonDefaultString(team.DefaultMemberRole, defaultTeamMemberRole),
+		MembersCanCreatePipelines: trueOrNil(team.MembersCanCreatePipelines),
+
+		Organization: &orgSlug,
+	}
+}
+
+// normalizeMRTTeamEmpties is the equivalent of normalizeMRTPipelineEmpties
+// for teams.
+func normalizeMRTTeamEmpties(got, want *teamMRT) *teamMRT {
+	normalizeEmptyString(&got.Description, want.Description)
+	normalizeDefaultString(&got.Privacy, want.Privacy, defaultTeamPrivacy)
+	normalizeDefaultString(&got.DefaultMemberRole, want.DefaultMemberRole, defaultTeamMemberRole)
+	normalizeFalse(&got.IsDefaultTeam, want.IsDefaultTeam)
+	normalizeFalse(&got.MembersCanCreatePipelines, want.MembersCanCreatePipelines)
+	return got
+}
+
+func normalizeDefaultString(got **string, want *string, def string) {
+	if *got == nil && want != nil && *want == def {
+		*got = want
+	}
+}
+
+func nonDefaultString(s *string, def string) *string {
+	if s == nil || *s == def {
+		return nil
+	}
+	return s
+}
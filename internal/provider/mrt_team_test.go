@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apparentlymart/terraform-sdk/tftest"
+)
+
+func TestMRTTeam(t *testing.T) {
+	tftest.AcceptanceTest(t)
+
+	t.Run("basic", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_team" "test" {
+	name = "terraform-provider-buildkite-test-team"
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+
+		// TODO: Check the state, once the tftest package allows that.
+	})
+	t.Run("update", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer func() {
+			wd.RequireSetConfig(t, `// empty for destroy`)
+			wd.RequireApply(t)
+		}()
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_team" "test" {
+	name        = "terraform-provider-buildkite-test-team-update"
+	description = "Created by the Buildkite provider's acceptance tests"
+}
+`)
+
+		wd.RequireInit(t)
+		wd.RequireApply(t)
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_team" "test" {
+	name                         = "terraform-provider-buildkite-test-team-updated"
+	privacy                      = "SECRET"
+	default_member_role          = "MAINTAINER"
+	members_can_create_pipelines = true
+}
+`)
+
+		wd.RequireApply(t)
+
+		// Removing the settings from the configuration resets them to
+		// Buildkite's defaults.
+		wd.RequireSetConfig(t, `
+resource "buildkite_team" "test" {
+	name = "terraform-provider-buildkite-test-team-updated"
+}
+`)
+
+		wd.RequireApply(t)
+	})
+	t.Run("invalid privacy", func(t *testing.T) {
+		wd := testHelper.RequireNewWorkingDir(t)
+		defer wd.Close()
+
+		wd.RequireSetConfig(t, `
+resource "buildkite_team" "test" {
+	name    = "terraform-provider-buildkite-test-team-invalid"
+	privacy = "PUBLIC"
+}
+`)
+
+		wd.RequireInit(t)
+		err := wd.Apply()
+		if err == nil {
+			t.Fatalf("apply succeeded; want error")
+		}
+		if got, want := err.Error(), `must be either "VISIBLE" or "SECRET"`; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:\n%s\nwant: %s", got, want)
+		}
+	})
+}
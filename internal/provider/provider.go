@@ -6,8 +6,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sync"
 
 	tfsdk "github.com/apparentlymart/terraform-sdk"
+	"github.com/apparentlymart/terraform-sdk/tfobj"
 	"github.com/apparentlymart/terraform-sdk/tfschema"
 	"github.com/buildkite/go-buildkite/buildkite"
 	"github.com/zclconf/go-cty/cty"
@@ -26,6 +28,7 @@ func Provider() *tfsdk.Provider {
 
 		ManagedResourceTypes: map[string]tfsdk.ManagedResourceType{
 			"buildkite_pipeline": pipelineManagedResourceType(),
+			"buildkite_team":     teamManagedResourceType(),
 		},
 
 		DataResourceTypes: map[string]tfsdk.DataResourceType{
@@ -45,58 +48,208 @@ func configure(ctx context.Context, config *Config) (*Meta, tfsdk.Diagnostics) {
 	}
 	if orgName == "" {
 		diags = diags.Append(tfsdk.Diagnostic{
-			Summary: "No Buildkite organization configured",
-			Detail:  "The \"organization\" argument is required, unless the BUILDKITE_ORGANIZATION environment variable is set.",
-			Path:    cty.GetAttrPath("organization"),
+			Severity: tfsdk.Error,
+			Summary:  "No Buildkite organization configured",
+			Detail:   "The \"organization\" argument is required, unless the BUILDKITE_ORGANIZATION environment variable is set.",
+			Path:     cty.GetAttrPath("organization"),
 		})
 	}
 
 	token := apiToken()
 	if token == "" {
 		diags = diags.Append(tfsdk.Diagnostic{
-			Summary: "No Buildkite API token available",
-			Detail:  "Set the BUILDKITE_TOKEN environment variable to your Buildkite API key.",
+			Severity: tfsdk.Error,
+			Summary:  "No Buildkite API token available",
+			Detail:   "Set the BUILDKITE_TOKEN environment variable to your Buildkite API key.",
 		})
-		return nil, diags
 	}
 
-	client, err := newBuildkiteClient(token)
-	if err != nil {
-		diags = diags.Append(tfsdk.Diagnostic{
-			Summary: "Buildkite API client creation failed",
-			Detail:  fmt.Sprintf("Failed to initialize the Buildkite API client: %s.", err),
-		})
+	if diags.HasErrors() {
 		return nil, diags
 	}
 
+	// We don't contact the Buildkite API here, because some operations (such
+	// as refreshing and destroying existing pipelines) can work using only
+	// the organization recorded in the state. Instead, the client and the
+	// configured organization are prepared on first use.
+	return &Meta{
+		config:  config,
+		token:   token,
+		orgSlug: orgName,
+	}, diags
+}
+
+type Config struct {
+	Organization *string `cty:"organization"`
+}
+
+type Meta struct {
+	config  *Config
+	token   string
+	orgSlug string
+
+	clientOnce  sync.Once
+	client      *buildkite.Client
+	clientDiags tfsdk.Diagnostics
+
+	orgOnce  sync.Once
+	org      *buildkite.Organization
+	orgDiags tfsdk.Diagnostics
+
+	// otherOrgs caches the lookups of organizations other than the one
+	// in the provider configuration, keyed by slug.
+	otherOrgsMu sync.Mutex
+	otherOrgs   map[string]*orgLookup
+}
+
+// orgLookup is the cached result of retrieving an organization from the API.
+type orgLookup struct {
+	once  sync.Once
+	org   *buildkite.Organization
+	diags tfsdk.Diagnostics
+}
+
+// apiClient returns the Buildkite API client, creating it first if this is
+// the first call.
+//
+// It is safe to call apiClient on a nil Meta, which is what resource type
+// functions receive if the provider configuration failed. In that case the
+// result is an error diagnostic.
+func (m *Meta) apiClient() (*buildkite.Client, tfsdk.Diagnostics) {
+	if m == nil {
+		return nil, providerNotConfiguredDiags()
+	}
+
+	m.clientOnce.Do(func() {
+		client, err := newBuildkiteClient(m.token)
+		if err != nil {
+			m.clientDiags = m.clientDiags.Append(tfsdk.Diagnostic{
+				Severity: tfsdk.Error,
+				Summary:  "Buildkite API client creation failed",
+				Detail:   fmt.Sprintf("Failed to initialize the Buildkite API client: %s.", err),
+			})
+			return
+		}
+		m.client = client
+	})
+
+	return m.client, copyDiags(m.clientDiags)
+}
+
+// defaultOrg returns the organization given in the provider configuration,
+// fetching it from the API first if this is the first call.
+//
+// Fetching the organization also serves to check that it exists and that the
+// given credentials are valid to work with it.
+func (m *Meta) defaultOrg() (*buildkite.Organization, tfsdk.Diagnostics) {
+	if m == nil {
+		return nil, providerNotConfiguredDiags()
+	}
+
+	m.orgOnce.Do(func() {
+		m.org, m.orgDiags = m.fetchOrg(m.orgSlug)
+	})
+
+	return m.org, copyDiags(m.orgDiags)
+}
+
+// organization returns the organization with the given slug, fetching it
+// from the API first if this is the first call for that slug.
+//
+// Like defaultOrg, fetching the organization checks that it exists and that
+// the given credentials are valid to work with it. Each organization is
+// fetched only once, even if several operations request it concurrently.
+func (m *Meta) organization(slug string) (*buildkite.Organization, tfsdk.Diagnostics) {
+	if m == nil {
+		return nil, providerNotConfiguredDiags()
+	}
+	if slug == m.orgSlug {
+		return m.defaultOrg()
+	}
+
+	m.otherOrgsMu.Lock()
+	if m.otherOrgs == nil {
+		m.otherOrgs = make(map[string]*orgLookup)
+	}
+	lookup, exists := m.otherOrgs[slug]
+	if !exists {
+		lookup = &orgLookup{}
+		m.otherOrgs[slug] = lookup
+	}
+	m.otherOrgsMu.Unlock()
+
+	lookup.once.Do(func() {
+		lookup.org, lookup.diags = m.fetchOrg(slug)
+	})
+
+	return lookup.org, copyDiags(lookup.diags)
+}
+
+// planOrganization sets the planned value of the "organization" argument of
+// a resource that belongs to an organization, using the organization from
+// the provider configuration if the argument is not set. It checks that the
+// organization exists, and plans to replace the resource if its
+// organization changes.
+func planOrganization(meta *Meta, plan tfobj.PlanBuilder) tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+
+	// The argument is computed, so we must check the configuration to see
+	// whether it is set.
+	if orgVal := plan.ConfigReader().Attr("organization"); orgVal.IsNull() {
+		org, moreDiags := meta.defaultOrg()
+		diags = diags.Append(moreDiags)
+		if diags.HasErrors() {
+			return diags
+		}
+		plan.SetAttr("organization", cty.StringVal(*org.Slug))
+	} else if orgVal.IsKnown() {
+		_, moreDiags := meta.organization(orgVal.AsString())
+		diags = diags.Append(moreDiags.UnderPath(cty.GetAttrPath("organization")))
+		if diags.HasErrors() {
+			return diags
+		}
+	}
+	if plan.Action() != tfobj.Create && attrHasChange(plan, "organization") {
+		plan.SetAttrRequiresReplacement("organization")
+	}
+
+	return diags
+}
+
+// fetchOrg retrieves the organization with the given slug from the API.
+func (m *Meta) fetchOrg(slug string) (*buildkite.Organization, tfsdk.Diagnostics) {
+	var diags tfsdk.Diagnostics
+
+	client, moreDiags := m.apiClient()
+	diags = diags.Append(moreDiags)
 	if diags.HasErrors() {
 		return nil, diags
 	}
 
-	// We'll fetch our organization just to sure it exists and also
-	// that the given credentials are valid to work with it.
-	org, resp, err := client.Organizations.Get(orgName)
+	org, resp, err := client.Organizations.Get(slug)
 	if resp != nil {
 		switch resp.StatusCode {
 		case http.StatusNotFound:
 			diags = diags.Append(tfsdk.Diagnostic{
-				Summary: "Buildkite organization not found",
-				Detail:  fmt.Sprintf("Cannot find organization %q. Either the organization does not exist or your current API credentials do not have API access to it.", orgName),
-				Path:    cty.GetAttrPath("organization"),
+				Severity: tfsdk.Error,
+				Summary:  "Buildkite organization not found",
+				Detail:   fmt.Sprintf("Cannot find organization %q. Either the organization does not exist or your current API credentials do not have API access to it.", slug),
 			})
 			return nil, diags
 		case http.StatusUnauthorized:
 			diags = diags.Append(tfsdk.Diagnostic{
-				Summary: "Invalid Buildkite API token",
-				Detail:  "The Buildkite API rejected the given API token.",
+				Severity: tfsdk.Error,
+				Summary:  "Invalid Buildkite API token",
+				Detail:   "The Buildkite API rejected the given API token.",
 			})
 			return nil, diags
 		case http.StatusOK:
 			// This is fine.
 		default:
 			diags = diags.Append(tfsdk.Diagnostic{
-				Summary: "Failed to retrieve Buildkite organization",
-				Detail:  fmt.Sprintf("The Buildkite API returned an unexpected response code: %s.", resp.Status),
+				Severity: tfsdk.Error,
+				Summary:  "Failed to retrieve Buildkite organization",
+				Detail:   fmt.Sprintf("The Buildkite API returned an unexpected response code: %s.", resp.Status),
 			})
 			return nil, diags
 		}
@@ -107,22 +260,26 @@ func configure(ctx context.Context, config *Config) (*Meta, tfsdk.Diagnostics) {
 	}
 
 	log.Printf("[INFO] Organization %q (%q) has id %q", *org.Slug, *org.Name, *org.ID)
-
-	return &Meta{
-		config: config,
-		client: client,
-		org:    org,
-	}, nil
+	return org, diags
 }
 
-type Config struct {
-	Organization *string `cty:"organization"`
+func providerNotConfiguredDiags() tfsdk.Diagnostics {
+	var diags tfsdk.Diagnostics
+	return diags.Append(tfsdk.Diagnostic{
+		Severity: tfsdk.Error,
+		Summary:  "Provider not configured",
+		Detail:   "The Buildkite provider configuration is not valid, so this operation cannot proceed. Correct the errors reported for the provider configuration and try again.",
+	})
 }
 
-type Meta struct {
-	config *Config
-	client *buildkite.Client
-	org    *buildkite.Organization
+// copyDiags returns a copy of the given diagnostics, so that a caller can
+// safely modify the result (for example, with UnderPath) without affecting
+// diagnostics that are cached and shared between operations.
+func copyDiags(diags tfsdk.Diagnostics) tfsdk.Diagnostics {
+	if len(diags) == 0 {
+		return nil
+	}
+	return append(tfsdk.Diagnostics(nil), diags...)
 }
 
 func apiConnectionError(err error) tfsdk.Diagnostic {